@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// aggregateCheckName is the check name of the per workload or per namespace
+// summary events.
+const aggregateCheckName = "kubernetes-events"
+
+// maxOwnerDepth bounds how far owner references are followed, e.g. Pod ->
+// ReplicaSet -> Deployment, or Pod -> Job -> CronJob.
+const maxOwnerDepth = 5
+
+// owningWorkload returns the workload owning the object represented by the
+// entity of a Kubernetes event, following the controller owner references up
+// to the top-level workload (e.g. Pod -> ReplicaSet -> Deployment). Objects
+// that aren't owned (or can't be looked up) are their own workload.
+func owningWorkload(k8sEvent k8scorev1.Event, cache *objectCache) (k8scorev1.ObjectReference, error) {
+	ref := entityReference(k8sEvent)
+	namespace := ref.Namespace
+
+	for i := 0; i < maxOwnerDepth; i++ {
+		meta, err := cache.getObjectMeta(ref, namespace)
+		if err == errUnsupportedKind {
+			break
+		} else if err != nil {
+			return ref, err
+		}
+		if meta == nil || len(meta.OwnerReferences) == 0 {
+			break
+		}
+		owner := meta.OwnerReferences[0]
+		for _, o := range meta.OwnerReferences {
+			if o.Controller != nil && *o.Controller {
+				owner = o
+				break
+			}
+		}
+		ref = k8scorev1.ObjectReference{Kind: owner.Kind, Namespace: namespace, Name: owner.Name}
+	}
+
+	return ref, nil
+}
+
+// workloadEntityName returns the entity name of a workload, following the
+// naming of the "Sensu Entity" section of createSensuEvent.
+func workloadEntityName(ref k8scorev1.ObjectReference) string {
+	lowerKind := strings.ToLower(ref.Kind)
+	lowerName := strings.ToLower(ref.Name)
+	switch lowerKind {
+	case "pod", "deployment", "endpoints", "node", "replicaset":
+		return lowerName
+	default:
+		return fmt.Sprintf("%s-%s", lowerName, lowerKind)
+	}
+}
+
+// namespaceEntityName returns the entity name of a Kubernetes namespace, or of
+// the cluster for cluster scoped objects.
+func namespaceEntityName(namespace string) string {
+	if len(namespace) == 0 {
+		return "cluster"
+	}
+	return fmt.Sprintf("%s-namespace", strings.ToLower(namespace))
+}
+
+// namespaceReference returns a reference to a Kubernetes namespace, or to the
+// cluster (named by --cluster) for cluster scoped objects, the objects of the
+// entities of namespaceEntityName.
+func namespaceReference(namespace string) k8scorev1.ObjectReference {
+	if len(namespace) == 0 {
+		return k8scorev1.ObjectReference{Kind: "Cluster", Name: plugin.Cluster}
+	}
+	return k8scorev1.ObjectReference{Kind: "Namespace", Name: namespace}
+}
+
+// summaryEvent is an event summarizing the events of several objects, about
+// the object represented by its entity, e.g. their workload or namespace.
+type summaryEvent struct {
+	*corev2.Event
+	object k8scorev1.ObjectReference
+	// sources are the Kubernetes events summarized, to be recorded as
+	// forwarded once the summary is delivered (see --dedup)
+	sources []k8scorev1.Event
+}
+
+// eventGroup is a group of events aggregated into a single event.
+type eventGroup struct {
+	entity      string
+	object      k8scorev1.ObjectReference
+	description string
+	namespace   string
+	status      uint32
+	handlers    []string
+	count       int
+	reasons     map[string]int
+	affected    map[string]bool
+	sources     []k8scorev1.Event
+}
+
+// aggregator groups events by owning workload or by namespace (see
+// --aggregate), to send one event per group instead of one per object.
+type aggregator struct {
+	cache  *objectCache
+	groups map[string]*eventGroup
+	order  []string
+}
+
+func newAggregator(cache *objectCache) *aggregator {
+	return &aggregator{
+		cache:  cache,
+		groups: make(map[string]*eventGroup),
+	}
+}
+
+// add adds the event created for a Kubernetes event to its group.
+func (a *aggregator) add(event *corev2.Event, k8sEvent k8scorev1.Event) error {
+	var entity, description string
+	var object k8scorev1.ObjectReference
+	switch plugin.Aggregate {
+	case "namespace":
+		_, namespace, _ := entityObject(k8sEvent)
+		entity = namespaceEntityName(namespace)
+		object = namespaceReference(namespace)
+		if len(namespace) == 0 {
+			description = "cluster scoped objects"
+		} else {
+			description = fmt.Sprintf("namespace %s", namespace)
+		}
+	default:
+		workload, err := owningWorkload(k8sEvent, a.cache)
+		if err != nil {
+			return err
+		}
+		entity = workloadEntityName(workload)
+		object = workload
+		description = fmt.Sprintf("%s %s", strings.ToLower(workload.Kind), objectKey(workload))
+	}
+
+	key := fmt.Sprintf("%s/%s", event.ObjectMeta.Namespace, entity)
+	group, ok := a.groups[key]
+	if !ok {
+		group = &eventGroup{
+			entity:      entity,
+			object:      object,
+			description: description,
+			namespace:   event.ObjectMeta.Namespace,
+			handlers:    event.Check.Handlers,
+			status:      event.Check.Status,
+			reasons:     make(map[string]int),
+			affected:    make(map[string]bool),
+		}
+		a.groups[key] = group
+		a.order = append(a.order, key)
+	}
+	group.count++
+	group.sources = append(group.sources, k8sEvent)
+	group.reasons[k8sEvent.Reason]++
+	group.affected[event.Check.ProxyEntityName] = true
+	if event.Check.Status > group.status {
+		// The handlers of the worst event are used for the group
+		group.status = event.Check.Status
+		group.handlers = event.Check.Handlers
+	}
+	return nil
+}
+
+// events returns one event per group, with the worst status of the group, a
+// breakdown of its events by reason and the list of affected entities.
+func (a *aggregator) events() []summaryEvent {
+	events := []summaryEvent{}
+	for _, key := range a.order {
+		group := a.groups[key]
+
+		affected := make([]string, 0, len(group.affected))
+		for name := range group.affected {
+			affected = append(affected, name)
+		}
+		sort.Strings(affected)
+
+		event := &corev2.Event{}
+		event.ObjectMeta.Namespace = group.namespace
+		event.ObjectMeta.Labels = map[string]string{
+			"io.kubernetes.count": strconv.Itoa(group.count),
+		}
+		event.Check = &corev2.Check{}
+		event.Check.ObjectMeta.Name = aggregateCheckName
+		event.Check.ObjectMeta.Namespace = group.namespace
+		event.Check.ProxyEntityName = group.entity
+		event.Check.Status = group.status
+		event.Check.Interval = plugin.Interval
+		event.Check.Handlers = group.handlers
+		event.Timestamp = time.Now().Unix()
+		event.Check.Output = fmt.Sprintf(
+			"%d event(s) for %s, reasons: %s\nAffected: %s\n",
+			group.count,
+			group.description,
+			formatCounts(group.reasons),
+			strings.Join(affected, ", "),
+		)
+		events = append(events, summaryEvent{Event: event, object: group.object, sources: group.sources})
+	}
+	return events
+}
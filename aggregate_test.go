@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ownedBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func aggregateEvent(kind, name, reason string, status uint32) (*corev2.Event, k8scorev1.Event) {
+	event := &corev2.Event{Check: &corev2.Check{ProxyEntityName: name, Status: status, Handlers: []string{"default"}}}
+	if status == 2 {
+		event.Check.Handlers = []string{"pagerduty"}
+	}
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = kind
+	k8sev.InvolvedObject.Name = name
+	k8sev.InvolvedObject.Namespace = "default"
+	k8sev.Reason = reason
+	return event, k8sev
+}
+
+func TestOwningWorkload(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&k8scorev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-bbd465f66-rwb2d", Namespace: "default", OwnerReferences: ownedBy("ReplicaSet", "nginx-bbd465f66")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "nginx-bbd465f66", Namespace: "default", OwnerReferences: ownedBy("Deployment", "nginx")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}},
+		&k8scorev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "default"}},
+	)
+	cache := newObjectCache(clientset)
+
+	testcases := []struct {
+		kind     string
+		name     string
+		expected string
+		entity   string
+	}{
+		{"Pod", "nginx-bbd465f66-rwb2d", "Deployment/nginx", "nginx"},
+		{"ReplicaSet", "nginx-bbd465f66", "Deployment/nginx", "nginx"},
+		{"Pod", "standalone", "Pod/standalone", "standalone"},
+		{"Pod", "deleted", "Pod/deleted", "deleted"},
+		{"Service", "nginx", "Service/nginx", "nginx-service"},
+	}
+	for _, tc := range testcases {
+		_, k8sev := aggregateEvent(tc.kind, tc.name, "BackOff", 1)
+		ref, err := owningWorkload(k8sev, cache)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, ref.Kind+"/"+ref.Name)
+		assert.Equal(t, tc.entity, workloadEntityName(ref))
+	}
+}
+
+func TestAggregatorWorkload(t *testing.T) {
+	assert := assert.New(t)
+	plugin.Aggregate = "workload"
+	defer func() { plugin.Aggregate = "" }()
+
+	clientset := fake.NewSimpleClientset(
+		&k8scorev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default", OwnerReferences: ownedBy("ReplicaSet", "nginx-bbd465f66")}},
+		&k8scorev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-2", Namespace: "default", OwnerReferences: ownedBy("ReplicaSet", "nginx-bbd465f66")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "nginx-bbd465f66", Namespace: "default", OwnerReferences: ownedBy("Deployment", "nginx")}},
+	)
+	a := newAggregator(newObjectCache(clientset))
+
+	for _, ev := range []struct {
+		name   string
+		reason string
+		status uint32
+	}{
+		{"nginx-1", "BackOff", 1},
+		{"nginx-2", "BackOff", 1},
+		{"nginx-2", "Unhealthy", 2},
+		{"standalone", "Failed", 1},
+	} {
+		event, k8sev := aggregateEvent("Pod", ev.name, ev.reason, ev.status)
+		require.NoError(t, a.add(event, k8sev))
+	}
+
+	events := a.events()
+	require.Len(t, events, 2)
+
+	assert.Equal("kubernetes-events", events[0].Check.Name)
+	assert.Equal("nginx", events[0].Check.ProxyEntityName)
+	assert.Equal(uint32(2), events[0].Check.Status)
+	assert.Equal([]string{"pagerduty"}, events[0].Check.Handlers)
+	assert.Equal("3", events[0].Labels["io.kubernetes.count"])
+	assert.Equal("3 event(s) for deployment default/nginx, reasons: BackOff (2), Unhealthy (1)\nAffected: nginx-1, nginx-2\n", events[0].Check.Output)
+
+	assert.Equal("standalone", events[1].Check.ProxyEntityName)
+	assert.Equal(uint32(1), events[1].Check.Status)
+	assert.Equal([]string{"default"}, events[1].Check.Handlers)
+}
+
+func TestAggregatorNamespace(t *testing.T) {
+	assert := assert.New(t)
+	plugin.Aggregate = "namespace"
+	defer func() { plugin.Aggregate = "" }()
+
+	a := newAggregator(newObjectCache(fake.NewSimpleClientset()))
+	event, k8sev := aggregateEvent("Pod", "nginx-1", "BackOff", 1)
+	require.NoError(t, a.add(event, k8sev))
+	event, k8sev = aggregateEvent("Service", "nginx", "FailedToUpdateEndpoint", 1)
+	require.NoError(t, a.add(event, k8sev))
+	event, k8sev = aggregateEvent("Node", "node-1", "NodeNotReady", 2)
+	k8sev.InvolvedObject.Namespace = ""
+	require.NoError(t, a.add(event, k8sev))
+
+	events := a.events()
+	require.Len(t, events, 2)
+	assert.Equal("default-namespace", events[0].Check.ProxyEntityName)
+	assert.Equal("2 event(s) for namespace default, reasons: BackOff (1), FailedToUpdateEndpoint (1)\nAffected: nginx, nginx-1\n", events[0].Check.Output)
+	assert.Equal("cluster", events[1].Check.ProxyEntityName)
+	assert.Equal(uint32(2), events[1].Check.Status)
+
+	// For their proxy entities
+	assert.Equal(k8scorev1.ObjectReference{Kind: "Namespace", Name: "default"}, events[0].object)
+	assert.Equal("Cluster", events[1].object.Kind)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// batchWait is the parsed --batch-wait
+var batchWait time.Duration
+
+// batchSink is a sink accepting several events per request.
+type batchSink interface {
+	eventSink
+	submitBatch(events []*corev2.Event) error
+}
+
+// batchFlusher is a sink queuing events, which must be flushed at the end of
+// a run.
+type batchFlusher interface {
+	flushBatch() error
+}
+
+// batchError is the error of a batch that failed to be delivered, with its
+// events for them to be spooled.
+type batchError struct {
+	events []*corev2.Event
+	err    error
+}
+
+func (e batchError) Error() string {
+	return fmt.Sprintf("Failed to deliver a batch of %d event(s): %v", len(e.events), e.err)
+}
+
+// collectorSink posts events as JSON arrays to the --collector-url, for
+// collectors accepting several events per request.
+type collectorSink struct{}
+
+func (s collectorSink) submit(event *corev2.Event) error {
+	return s.submitBatch([]*corev2.Event{event})
+}
+
+func (collectorSink) submitBatch(events []*corev2.Event) error {
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("Failed to encode events: %v", err)
+	}
+	req, err := http.NewRequestWithContext(apiContext, http.MethodPost, plugin.CollectorURL, bytes.NewBuffer(encoded))
+	if err != nil {
+		return fmt.Errorf("Failed to create request to %s: %v", plugin.CollectorURL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to post events to %s: %v", plugin.CollectorURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("POST of %d event(s) to %s failed with status %v: %s", len(events), plugin.CollectorURL, resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+			return rejectedEventError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// batchingSink queues events to deliver them in batches of --batch-size, or
+// once the oldest one waited for --batch-wait.
+type batchingSink struct {
+	sink batchSink
+	size int
+	wait time.Duration
+
+	queued []*corev2.Event
+	// since is when the oldest queued event was queued
+	since time.Time
+}
+
+func newBatchingSink(sink batchSink, size int, wait time.Duration) *batchingSink {
+	return &batchingSink{sink: sink, size: size, wait: wait}
+}
+
+func (s *batchingSink) submit(event *corev2.Event) error {
+	if len(s.queued) == 0 {
+		s.since = time.Now()
+	}
+	s.queued = append(s.queued, event)
+	if len(s.queued) >= s.size || time.Since(s.since) >= s.wait {
+		return s.flushBatch()
+	}
+	return nil
+}
+
+// flushBatch delivers the queued events.
+func (s *batchingSink) flushBatch() error {
+	if len(s.queued) == 0 {
+		return nil
+	}
+	events := s.queued
+	s.queued = nil
+
+	start := time.Now()
+	err := s.sink.submitBatch(events)
+	for range events {
+		telemetry.eventDelivered(time.Since(start), err)
+	}
+	entry := pipelineLog().WithFields(logrus.Fields{
+		"events":   len(events),
+		"duration": time.Since(start),
+	})
+	if _, ok := err.(rejectedEventError); ok {
+		entry.WithError(err).Debug("Batch rejected")
+		return err
+	} else if err != nil {
+		entry.WithError(err).Debug("Batch delivery failed")
+		return batchError{events: events, err: err}
+	}
+	entry.Debug("Batch delivered")
+	return nil
+}
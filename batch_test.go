@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchingSink(t *testing.T) {
+	assert := assert.New(t)
+	batches := []int{}
+	status := http.StatusOK
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events := []*corev2.Event{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+		batches = append(batches, len(events))
+		w.WriteHeader(status)
+	}))
+	defer test.Close()
+	plugin.CollectorURL = test.URL
+	defer func() { plugin.CollectorURL = "" }()
+
+	s := newBatchingSink(collectorSink{}, 3, time.Hour)
+	for _, check := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, s.submit(spoolEvent(check)))
+	}
+	assert.Equal([]int{3}, batches)
+	require.NoError(t, s.flushBatch())
+	require.NoError(t, s.flushBatch())
+	assert.Equal([]int{3, 1}, batches)
+
+	// Events that waited long enough are sent with the next one
+	s = newBatchingSink(collectorSink{}, 3, time.Millisecond)
+	require.NoError(t, s.submit(spoolEvent("a")))
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, s.submit(spoolEvent("b")))
+	assert.Equal([]int{3, 1, 2}, batches)
+
+	// Failed batches are returned with their events, rejected ones are not
+	status = http.StatusServiceUnavailable
+	require.NoError(t, s.submit(spoolEvent("a")))
+	err := s.flushBatch()
+	require.IsType(t, batchError{}, err)
+	assert.Len(err.(batchError).events, 1)
+	status = http.StatusBadRequest
+	require.NoError(t, s.submit(spoolEvent("a")))
+	assert.IsType(rejectedEventError{}, s.flushBatch())
+}
+
+func TestSpoolingBatchingSink(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	up := false
+	posted := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		posted++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer test.Close()
+	plugin.CollectorURL = test.URL
+	defer func() { plugin.CollectorURL = "" }()
+
+	// The whole batch that failed is spooled
+	s := newSpoolingSink(newBatchingSink(collectorSink{}, 10, time.Hour), eventSpool{dir: dir, max: 10})
+	require.NoError(t, s.submit(spoolEvent("a")))
+	require.NoError(t, s.submit(spoolEvent("b")))
+	require.NoError(t, s.flushBatch())
+	assert.Equal(2, s.depth())
+
+	// Spooled events are replayed one by one, new ones batched
+	up = true
+	s = newSpoolingSink(newBatchingSink(collectorSink{}, 10, time.Hour), eventSpool{dir: dir, max: 10})
+	require.NoError(t, s.submit(spoolEvent("c")))
+	assert.Equal(2, posted)
+	require.NoError(t, s.flushBatch())
+	assert.Equal(3, posted)
+	assert.Equal(0, s.depth())
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// watchRetryDelay is how long to wait before watching events again after the
+// Kubernetes API failed.
+const watchRetryDelay = 5 * time.Second
+
+// daemonMode reports whether --daemon is set, before the arguments are parsed,
+// as there is no event to read from STDIN in daemon mode.
+func daemonMode(args []string) bool {
+	daemon, _ := strconv.ParseBool(os.Getenv("KUBERNETES_DAEMON"))
+	for _, arg := range args {
+		if arg == "--daemon" {
+			daemon = true
+		} else if strings.HasPrefix(arg, "--daemon=") {
+			daemon, _ = strconv.ParseBool(strings.TrimPrefix(arg, "--daemon="))
+		}
+	}
+	return daemon
+}
+
+// daemon watches Kubernetes events and processes them as they happen. The
+// events are processed in runs of --interval seconds, which bound the event
+// storm limits, aggregation and entity garbage collection like check runs do.
+type daemon struct {
+	clientset   kubernetes.Interface
+	namespace   string
+	listOptions metav1.ListOptions
+	// resourceVersions are the versions of the last event seen in each watched
+	// namespace (or in all of them), from which the watches resume
+	resourceVersions map[string]string
+	// watched are the namespaces watched
+	watched []string
+	// processors are the processors of the current run, one per pipeline
+	processors []*eventProcessor
+	// shard, if any, selects the namespaces this replica watches
+	shard *shardMembership
+}
+
+func newDaemon(clientset kubernetes.Interface, namespace string, listOptions metav1.ListOptions, shard *shardMembership) (*daemon, error) {
+	d := &daemon{
+		clientset:        clientset,
+		namespace:        namespace,
+		listOptions:      listOptions,
+		resourceVersions: make(map[string]string),
+		shard:            shard,
+	}
+	processors, err := newProcessors(clientset, pipelines)
+	if err != nil {
+		return nil, err
+	}
+	d.processors = processors
+	return d, nil
+}
+
+// newProcessors returns the processors of a run of pipelines.
+func newProcessors(clientset kubernetes.Interface, pipelines []*pipeline) ([]*eventProcessor, error) {
+	processors := []*eventProcessor{}
+	for _, p := range pipelines {
+		p.activate()
+		processor, err := newEventProcessor(clientset)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
+
+// runDaemon runs the daemon mode until it fails.
+func runDaemon(clientset kubernetes.Interface, namespace string, listOptions metav1.ListOptions) error {
+	if addr := plugin.MetricsAddr; len(addr) > 0 {
+		go func() {
+			if err := http.ListenAndServe(addr, telemetry.handler()); err != nil {
+				logger.Fatalf("Failed to serve metrics on %s: %v", addr, err)
+			}
+		}()
+	}
+
+	if plugin.LeaderElect {
+		return runLeaderElection(clientset, func(stop <-chan struct{}) error {
+			return watchEvents(clientset, namespace, listOptions, nil, stop)
+		})
+	}
+	if plugin.Shard {
+		shard, err := newShardMembership(clientset)
+		if err != nil {
+			return err
+		}
+		if err := shard.renew(time.Now()); err != nil {
+			return err
+		}
+		// The Lease is released once the events of this replica are drained
+		release := make(chan struct{})
+		defer close(release)
+		go shard.run(release)
+		return watchEvents(clientset, namespace, listOptions, shard, intakeContext.Done())
+	}
+	return watchEvents(clientset, namespace, listOptions, nil, intakeContext.Done())
+}
+
+// watchEvents watches and processes events until stopped, or until it fails.
+// Once stopped, the current run ends to drain the events taken in.
+func watchEvents(clientset kubernetes.Interface, namespace string, listOptions metav1.ListOptions, shard *shardMembership, stop <-chan struct{}) error {
+	d, err := newDaemon(clientset, namespace, listOptions, shard)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Duration(plugin.Interval) * time.Second)
+	defer ticker.Stop()
+	reloads := configReloads(plugin.ConfigFile, stop)
+	// Batches are delivered within --batch-wait, even without new events
+	var batchTicks <-chan time.Time
+	if plugin.BatchSize > 1 {
+		batchTicker := time.NewTicker(batchWait)
+		defer batchTicker.Stop()
+		batchTicks = batchTicker.C
+	}
+	var shardChanges <-chan struct{}
+	if shard != nil {
+		shardChanges = shard.changes
+	}
+
+	for {
+		events, err := d.watch()
+		if err != nil {
+			telemetry.setReady(false)
+			logger.Error(err)
+			select {
+			case <-stop:
+				return d.shutdown()
+			case <-time.After(watchRetryDelay):
+			}
+			continue
+		}
+		telemetry.setReady(true)
+
+		restart := false
+		for !restart {
+			select {
+			case item := <-events.events:
+				restart = item.closed || d.handle(item.namespace, item.event)
+			case <-ticker.C:
+				if err := d.endRun(); err != nil {
+					events.Stop()
+					return err
+				}
+				// Namespaces may have been created or deleted
+				restart = d.resharded()
+			case <-shardChanges:
+				restart = d.resharded()
+			case <-batchTicks:
+				d.flushBatches()
+			case <-reloads:
+				restart = d.reload()
+			case <-stop:
+				events.Stop()
+				return d.shutdown()
+			}
+		}
+		events.Stop()
+		telemetry.watchRestarted()
+	}
+}
+
+// watchedEvent is an event of the watch of a namespace.
+type watchedEvent struct {
+	namespace string
+	event     watch.Event
+	// closed is set once the watch of the namespace ended
+	closed bool
+}
+
+// eventWatch merges the watches of the events of several namespaces.
+type eventWatch struct {
+	watches []watch.Interface
+	events  chan watchedEvent
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newEventWatch() *eventWatch {
+	return &eventWatch{
+		events: make(chan watchedEvent),
+		stop:   make(chan struct{}),
+	}
+}
+
+// add merges the watch of the events of a namespace.
+func (w *eventWatch) add(namespace string, nsWatch watch.Interface) {
+	w.watches = append(w.watches, nsWatch)
+	go func() {
+		for item := range nsWatch.ResultChan() {
+			select {
+			case w.events <- watchedEvent{namespace: namespace, event: item}:
+			case <-w.stop:
+				return
+			}
+		}
+		select {
+		case w.events <- watchedEvent{namespace: namespace, closed: true}:
+		case <-w.stop:
+		}
+	}()
+}
+
+// Stop stops the watches.
+func (w *eventWatch) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+		for _, nsWatch := range w.watches {
+			nsWatch.Stop()
+		}
+	})
+}
+
+// watchedNamespaces returns the namespaces to watch: the namespace of the
+// settings (all of them if empty), or the namespaces of the shard of this
+// replica.
+func (d *daemon) watchedNamespaces() ([]string, error) {
+	if d.shard == nil {
+		return []string{d.namespace}, nil
+	}
+	candidates := []string{d.namespace}
+	if len(d.namespace) == 0 {
+		list, err := d.clientset.CoreV1().Namespaces().List(apiContext, metav1.ListOptions{})
+		if err != nil {
+			telemetry.apiError("kubernetes")
+			return nil, fmt.Errorf("Failed to list namespaces: %v", err)
+		}
+		candidates = []string{}
+		for _, namespace := range list.Items {
+			candidates = append(candidates, namespace.Name)
+		}
+	}
+	now := time.Now()
+	owned := []string{}
+	for _, namespace := range candidates {
+		if d.shard.owns(namespace, now) {
+			owned = append(owned, namespace)
+		}
+	}
+	sort.Strings(owned)
+	return owned, nil
+}
+
+// resharded reports whether the namespaces to watch changed, as the members
+// of the shard or the namespaces did.
+func (d *daemon) resharded() bool {
+	if d.shard == nil {
+		return false
+	}
+	namespaces, err := d.watchedNamespaces()
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	return strings.Join(namespaces, ",") != strings.Join(d.watched, ",")
+}
+
+// watch starts watching the events of the watched namespaces, each from the
+// last event seen in it.
+func (d *daemon) watch() (*eventWatch, error) {
+	namespaces, err := d.watchedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	watched := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		watched[namespace] = true
+	}
+	for namespace := range d.resourceVersions {
+		// Watched again from now on if it comes back to this replica
+		if !watched[namespace] {
+			delete(d.resourceVersions, namespace)
+		}
+	}
+
+	w := newEventWatch()
+	for _, namespace := range namespaces {
+		nsWatch, err := d.watchNamespace(namespace)
+		if err != nil {
+			w.Stop()
+			return nil, err
+		}
+		w.add(namespace, nsWatch)
+	}
+	if d.shard != nil && strings.Join(namespaces, ",") != strings.Join(d.watched, ",") {
+		logger.Infof("Watching the events of %d namespace(s) of the shard", len(namespaces))
+	}
+	d.watched = namespaces
+	return w, nil
+}
+
+// watchNamespace starts watching the events of a namespace (or of all of them
+// if empty) from the last event seen. Without one, the events are listed
+// first to only watch the events that happen from now on.
+func (d *daemon) watchNamespace(namespace string) (watch.Interface, error) {
+	events := d.clientset.CoreV1().Events(namespace)
+	if len(d.resourceVersions[namespace]) == 0 {
+		list, err := events.List(apiContext, d.listOptions)
+		if err != nil {
+			telemetry.apiError("kubernetes")
+			return nil, fmt.Errorf("Failed to get events: %v", err)
+		}
+		d.resourceVersions[namespace] = list.ResourceVersion
+	}
+
+	options := d.listOptions
+	options.ResourceVersion = d.resourceVersions[namespace]
+	options.AllowWatchBookmarks = true
+	w, err := events.Watch(apiContext, options)
+	if err != nil {
+		telemetry.apiError("kubernetes")
+		return nil, fmt.Errorf("Failed to watch events: %v", err)
+	}
+	return w, nil
+}
+
+// handle handles an event of the watch of a namespace, and reports whether
+// the watch must be restarted.
+func (d *daemon) handle(namespace string, item watch.Event) bool {
+	switch item.Type {
+	case watch.Error:
+		telemetry.apiError("kubernetes")
+		err := k8serrors.FromObject(item.Object)
+		if k8serrors.IsResourceExpired(err) || k8serrors.IsGone(err) {
+			// Too old to resume from, list again
+			delete(d.resourceVersions, namespace)
+		}
+		logger.Warnf("Failed to watch events: %v", err)
+		return true
+	case watch.Added, watch.Modified, watch.Bookmark:
+		k8sEvent, ok := item.Object.(*k8scorev1.Event)
+		if !ok {
+			return false
+		}
+		d.resourceVersions[namespace] = k8sEvent.ResourceVersion
+		if item.Type != watch.Added {
+			// Like check runs, only alert on the first occurrence of an event
+			eventLog(*k8sEvent).WithField("filter", "modified").Debug("Event filtered: not its first occurrence")
+			return false
+		}
+		if d.shard != nil && !d.shard.owns(eventNamespace(*k8sEvent), time.Now()) {
+			// Until the watch of a namespace that moved is stopped
+			eventLog(*k8sEvent).WithField("filter", "other_shard").Debug("Event filtered: namespace owned by another replica")
+			telemetry.eventFiltered("other_shard")
+			return false
+		}
+		for i, p := range pipelines {
+			p.activate()
+			selected, err := eventSelected(*k8sEvent)
+			if err == nil && selected {
+				var summary string
+				summary, err = d.processors[i].handle(*k8sEvent)
+				if len(summary) > 0 {
+					pipelineLog().Info(summary)
+				}
+			} else if err == nil {
+				eventLog(*k8sEvent).WithField("filter", "pipeline").Debug("Event filtered: not selected by the pipeline")
+			}
+			if err != nil {
+				eventLog(*k8sEvent).Errorf("Failed to process event: %v", err)
+			}
+		}
+	}
+	return false
+}
+
+// endRun ends the current run and starts a new one.
+func (d *daemon) endRun() error {
+	d.scanPods()
+	// Failures are logged, the next run goes on
+	_ = d.flush()
+	processors, err := newProcessors(d.clientset, pipelines)
+	if err != nil {
+		return err
+	}
+	d.processors = processors
+	return nil
+}
+
+// flush sends the aggregated events of the current run, saves the
+// deduplication state and garbage collects entities. It returns the last
+// failure to send events or save the state.
+func (d *daemon) flush() error {
+	var failure error
+	for i, p := range pipelines {
+		p.activate()
+		output, err := d.processors[i].flush()
+		if err != nil {
+			pipelineLog().Error(err)
+			failure = err
+		}
+		for _, out := range output {
+			pipelineLog().Info(out)
+		}
+		if plugin.GCEntities {
+			collected, err := d.processors[i].collectEntities()
+			if err != nil {
+				pipelineLog().Error(err)
+			}
+			for _, out := range collected {
+				pipelineLog().Info(out)
+			}
+		}
+	}
+	return failure
+}
+
+// scanPods processes the events of the container problems found in the
+// status of Pods, once per run (see --scan-pods).
+func (d *daemon) scanPods() {
+	for i, p := range pipelines {
+		p.activate()
+		if !plugin.ScanPods {
+			continue
+		}
+		scanned, err := d.processors[i].scanPods(time.Now())
+		if err != nil {
+			pipelineLog().Error(err)
+			continue
+		}
+		for _, k8sEvent := range scanned {
+			if d.shard != nil && !d.shard.owns(eventNamespace(k8sEvent), time.Now()) {
+				continue
+			}
+			summary, err := d.processors[i].handle(k8sEvent)
+			if err != nil {
+				eventLog(k8sEvent).Errorf("Failed to process event: %v", err)
+			} else if len(summary) > 0 {
+				pipelineLog().Info(summary)
+			}
+		}
+	}
+}
+
+// flushBatches delivers the events queued for batching.
+func (d *daemon) flushBatches() {
+	for i, p := range pipelines {
+		p.activate()
+		if err := d.processors[i].flushBatch(); err != nil {
+			pipelineLog().Error(err)
+		}
+	}
+}
+
+// shutdown ends the current run once the intake of events stopped, before the
+// --shutdown-grace-period is over.
+func (d *daemon) shutdown() error {
+	telemetry.setReady(false)
+	logger.Info("Stopped watching events, draining the current run")
+	if err := d.flush(); err != nil {
+		return fmt.Errorf("Failed to drain events on shutdown: %v", err)
+	}
+	logger.Info("Drained the current run")
+	return nil
+}
+
+// reload swaps in the pipelines of the --config file, once loaded and
+// validated, ending the current run. A config that fails to load is reported,
+// and the current pipelines keep processing events. It reports whether the
+// watch must be restarted, as the pipelines list events differently; it
+// resumes from the last event seen.
+func (d *daemon) reload() bool {
+	loaded, err := reloadPipelines()
+	var processors []*eventProcessor
+	if err == nil {
+		processors, err = newProcessors(d.clientset, loaded)
+	}
+	telemetry.configReloaded(err)
+	if err != nil {
+		logger.Errorf("Failed to reload --config, keeping the current pipelines: %v", err)
+		return false
+	}
+
+	_ = d.flush()
+	pipelines = loaded
+	d.processors = processors
+	logger.Infof("Reloaded --config with %d pipeline(s)", len(pipelines))
+
+	namespace, listOptions := sharedListOptions(pipelines)
+	restart := namespace != d.namespace || listOptions.FieldSelector != d.listOptions.FieldSelector || listOptions.LabelSelector != d.listOptions.LabelSelector
+	d.namespace = namespace
+	d.listOptions = listOptions
+	return restart
+}
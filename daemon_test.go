@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDaemonMode(t *testing.T) {
+	testcases := []struct {
+		args     []string
+		env      string
+		expected bool
+	}{
+		{[]string{}, "", false},
+		{[]string{"--namespace", "all"}, "", false},
+		{[]string{"--daemon"}, "", true},
+		{[]string{"--daemon=true"}, "", true},
+		{[]string{"--daemon=false"}, "true", false},
+		{[]string{}, "true", true},
+	}
+	defer os.Unsetenv("KUBERNETES_DAEMON")
+	for _, tc := range testcases {
+		os.Setenv("KUBERNETES_DAEMON", tc.env)
+		assert.Equal(t, tc.expected, daemonMode(tc.args), "%v %q", tc.args, tc.env)
+	}
+}
+
+func TestDaemonHandle(t *testing.T) {
+	assert := assert.New(t)
+	posted := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer test.Close()
+	base, baseDeduplicator := plugin, sharedDeduplicator
+	defer func() {
+		plugin = base
+		pipelines = nil
+		sharedDeduplicator = baseDeduplicator
+	}()
+	// Not selecting events by what other tests left
+	plugin = Config{PluginConfig: base.PluginConfig}
+	sharedDeduplicator = nil
+	plugin.AgentAPIURL = test.URL
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+
+	pipelines = []*pipeline{capturePipeline()}
+	d, err := newDaemon(fake.NewSimpleClientset(), "", metav1.ListOptions{}, nil)
+	require.NoError(t, err)
+
+	k8sev := &k8scorev1.Event{}
+	k8sev.ResourceVersion = "10"
+	k8sev.Name = "nginx.1"
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx"
+
+	assert.False(d.handle("", watch.Event{Type: watch.Added, Object: k8sev}))
+	assert.Equal("10", d.resourceVersions[""])
+	assert.Equal(1, posted)
+
+	modified := k8sev.DeepCopy()
+	modified.ResourceVersion = "11"
+	assert.False(d.handle("", watch.Event{Type: watch.Modified, Object: modified}))
+	assert.Equal("11", d.resourceVersions[""])
+	assert.Equal(1, posted)
+
+	gone := &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusGone, Reason: metav1.StatusReasonExpired}
+	assert.True(d.handle("", watch.Event{Type: watch.Error, Object: gone}))
+	assert.Empty(d.resourceVersions[""])
+
+	require.NoError(t, d.endRun())
+}
+
+func TestDaemonShutdown(t *testing.T) {
+	assert := assert.New(t)
+	posted := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer test.Close()
+	base, baseDeduplicator, baseTTL := plugin, sharedDeduplicator, dedupTTL
+	defer func() {
+		plugin = base
+		pipelines = nil
+		sharedDeduplicator = baseDeduplicator
+		dedupTTL = baseTTL
+	}()
+	plugin = Config{PluginConfig: base.PluginConfig}
+	sharedDeduplicator = nil
+	plugin.AgentAPIURL = test.URL
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.Aggregate = "namespace"
+	plugin.Dedup = "memory"
+	dedupTTL = time.Hour
+
+	pipelines = []*pipeline{capturePipeline()}
+	d, err := newDaemon(fake.NewSimpleClientset(), "", metav1.ListOptions{}, nil)
+	require.NoError(t, err)
+
+	k8sev := &k8scorev1.Event{}
+	k8sev.UID = "a"
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx"
+	assert.False(d.handle("", watch.Event{Type: watch.Added, Object: k8sev}))
+	assert.Equal(0, posted)
+
+	// The aggregated event taken in is delivered, and recorded as such
+	require.NoError(t, d.shutdown())
+	assert.Equal(1, posted)
+	entries, _, err := sharedDeduplicator.store.load()
+	require.NoError(t, err)
+	assert.Contains(entries, "a/0")
+}
+
+func TestDaemonShardWatch(t *testing.T) {
+	assert := assert.New(t)
+	base, baseDuration := plugin, leaderElectLeaseDuration
+	defer func() {
+		plugin = base
+		pipelines = nil
+		leaderElectLeaseDuration = baseDuration
+	}()
+	plugin = Config{PluginConfig: base.PluginConfig}
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.ShardLeasePrefix = "sensu-kubernetes-events-shard"
+	plugin.LeaderElectNamespace = "monitoring"
+	leaderElectLeaseDuration = 15 * time.Second
+	pipelines = []*pipeline{capturePipeline()}
+
+	clientset := fake.NewSimpleClientset()
+	for i := 0; i < 10; i++ {
+		namespace := &k8scorev1.Namespace{}
+		namespace.Name = fmt.Sprintf("team-%d", i)
+		_, err := clientset.CoreV1().Namespaces().Create(apiContext, namespace, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	daemons := []*daemon{}
+	now := time.Now()
+	for _, identity := range []string{"replica-1", "replica-2"} {
+		plugin.LeaderElectIdentity = identity
+		shard, err := newShardMembership(clientset)
+		require.NoError(t, err)
+		require.NoError(t, shard.renew(now))
+		d, err := newDaemon(clientset, "", metav1.ListOptions{}, shard)
+		require.NoError(t, err)
+		daemons = append(daemons, d)
+	}
+	require.NoError(t, daemons[0].shard.renew(now))
+
+	// Each replica only watches the namespaces it owns
+	w, err := daemons[0].watch()
+	require.NoError(t, err)
+	defer w.Stop()
+	other, err := daemons[1].watch()
+	require.NoError(t, err)
+	other.Stop()
+	assert.NotEmpty(daemons[0].watched)
+	assert.NotEmpty(daemons[1].watched)
+	assert.Len(append(daemons[0].watched, daemons[1].watched...), 10)
+	for _, namespace := range daemons[1].watched {
+		assert.NotContains(daemons[0].watched, namespace)
+	}
+
+	for _, namespace := range []string{daemons[1].watched[0], daemons[0].watched[0]} {
+		k8sev := &k8scorev1.Event{}
+		k8sev.Name = "nginx.1"
+		k8sev.Namespace = namespace
+		_, err := clientset.CoreV1().Events(namespace).Create(apiContext, k8sev, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	select {
+	case item := <-w.events:
+		assert.Equal(daemons[0].watched[0], item.namespace)
+		assert.Equal(watch.Added, item.event.Type)
+	case <-time.After(time.Second):
+		t.Fatal("No event watched")
+	}
+
+	// Once the other replica left, its namespaces are watched too
+	assert.False(daemons[0].resharded())
+	<-daemons[0].shard.changes
+	require.NoError(t, clientset.CoordinationV1().Leases("monitoring").Delete(apiContext, daemons[1].shard.leaseName(), metav1.DeleteOptions{}))
+	require.NoError(t, daemons[0].shard.renew(now))
+	<-daemons[0].shard.changes
+	assert.True(daemons[0].resharded())
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// dedupConfigMapKey is the key of the ConfigMap data holding the state.
+const dedupConfigMapKey = "forwarded.json"
+
+// dedupConfigMapMaxBytes bounds the size of the state in a ConfigMap, below
+// the 1 MiB limit of Kubernetes objects.
+const dedupConfigMapMaxBytes = 900 * 1024
+
+// dedupSaveAttempts bounds the attempts to save the state when it is changed
+// concurrently by another check run or replica.
+const dedupSaveAttempts = 5
+
+// errDedupConflict is returned by stores when the state changed since it was
+// loaded.
+var errDedupConflict = errors.New("deduplication state changed concurrently")
+
+// dedupStore persists the deduplication state: the keys of the forwarded
+// events and the Unix time they were forwarded at.
+type dedupStore interface {
+	// load returns the state and its version
+	load() (map[string]int64, string, error)
+	// save saves the state if it is still at the given version, or returns
+	// errDedupConflict
+	save(entries map[string]int64, version string) error
+}
+
+// memoryDedupStore keeps the state in memory, for the runs of the daemon mode.
+type memoryDedupStore struct {
+	mu      sync.Mutex
+	entries map[string]int64
+}
+
+func (s *memoryDedupStore) load() (map[string]int64, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make(map[string]int64, len(s.entries))
+	for key, t := range s.entries {
+		entries[key] = t
+	}
+	return entries, "", nil
+}
+
+func (s *memoryDedupStore) save(entries map[string]int64, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	return nil
+}
+
+// fileDedupStore keeps the state in a local JSON file, for check runs that
+// always run on the same agent.
+type fileDedupStore struct {
+	path string
+}
+
+func (s fileDedupStore) load() (map[string]int64, string, error) {
+	entries := map[string]int64{}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return entries, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("Failed to read %s: %v", s.path, err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, "", fmt.Errorf("Failed to parse %s: %v", s.path, err)
+	}
+	return entries, "", nil
+}
+
+func (s fileDedupStore) save(entries map[string]int64, _ string) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("Failed to encode deduplication state: %v", err)
+	}
+	// Write then rename, so that a failed write doesn't lose the state
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %v", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write %s: %v", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// configMapDedupStore keeps the state in a ConfigMap, shared by the check runs
+// on any agent and by replicas.
+type configMapDedupStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (s configMapDedupStore) load() (map[string]int64, string, error) {
+	entries := map[string]int64{}
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(apiContext, s.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return entries, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("Failed to get ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	if data, ok := cm.Data[dedupConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(data), &entries); err != nil {
+			return nil, "", fmt.Errorf("Failed to parse ConfigMap %s/%s: %v", s.namespace, s.name, err)
+		}
+	}
+	return entries, cm.ResourceVersion, nil
+}
+
+func (s configMapDedupStore) save(entries map[string]int64, version string) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("Failed to encode deduplication state: %v", err)
+	}
+	if len(data) > dedupConfigMapMaxBytes {
+		return fmt.Errorf("Failed to save ConfigMap %s/%s: the deduplication state of %d record(s) takes %d bytes, over the %d bytes a ConfigMap can hold, lower --dedup-max-entries", s.namespace, s.name, len(entries), len(data), dedupConfigMapMaxBytes)
+	}
+	cm := &k8scorev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.name,
+			Namespace:       s.namespace,
+			ResourceVersion: version,
+		},
+		Data: map[string]string{dedupConfigMapKey: string(data)},
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	if len(version) == 0 {
+		_, err = configMaps.Create(apiContext, cm, metav1.CreateOptions{})
+	} else {
+		_, err = configMaps.Update(apiContext, cm, metav1.UpdateOptions{})
+	}
+	if k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err) {
+		return errDedupConflict
+	} else if err != nil {
+		return fmt.Errorf("Failed to save ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	return nil
+}
+
+// newDedupStore returns the store selected by --dedup.
+func newDedupStore(client kubernetes.Interface) dedupStore {
+	switch plugin.Dedup {
+	case "file":
+		return fileDedupStore{path: plugin.DedupFile}
+	case "configmap":
+		namespace := plugin.DedupNamespace
+		if len(namespace) == 0 {
+			namespace = leaderElectionNamespace()
+		}
+		return configMapDedupStore{client: client, namespace: namespace, name: plugin.DedupConfigMap}
+	default:
+		return &memoryDedupStore{}
+	}
+}
+
+// dedupTTL is the parsed --dedup-ttl
+var dedupTTL time.Duration
+
+// sharedDeduplicator is the deduplicator of the process, shared by the runs of
+// the daemon mode.
+var sharedDeduplicator *deduplicator
+
+// dedupKey identifies an occurrence of a Kubernetes event, in the current
+// pipeline if any.
+func dedupKey(k8sEvent k8scorev1.Event) string {
+	key := fmt.Sprintf("%s/%d", k8sEvent.UID, k8sEvent.Count)
+	if len(plugin.Pipeline) > 0 {
+		key = fmt.Sprintf("%s/%s", plugin.Pipeline, key)
+	}
+	return key
+}
+
+// deduplicator records the Kubernetes events already forwarded, to not forward
+// them again in the overlapping runs of the check (see --dedup).
+type deduplicator struct {
+	store dedupStore
+	ttl   time.Duration
+	// max bounds the number of entries, the oldest being dropped
+	max     int
+	entries map[string]int64
+	// recorded are the entries recorded since the state was loaded
+	recorded map[string]int64
+}
+
+func newDeduplicator(store dedupStore, ttl time.Duration, max int) *deduplicator {
+	return &deduplicator{
+		store:    store,
+		ttl:      ttl,
+		max:      max,
+		recorded: make(map[string]int64),
+	}
+}
+
+// seen reports whether a Kubernetes event was already forwarded, loading the
+// state on first use.
+func (d *deduplicator) seen(k8sEvent k8scorev1.Event) (bool, error) {
+	if d.entries == nil {
+		entries, _, err := d.store.load()
+		if err != nil {
+			return false, err
+		}
+		d.entries = entries
+	}
+	_, ok := d.entries[dedupKey(k8sEvent)]
+	return ok, nil
+}
+
+// record records a Kubernetes event as forwarded.
+func (d *deduplicator) record(k8sEvent k8scorev1.Event, now time.Time) {
+	key := dedupKey(k8sEvent)
+	if d.entries == nil {
+		d.entries = make(map[string]int64)
+	}
+	d.entries[key] = now.Unix()
+	d.recorded[key] = now.Unix()
+}
+
+// save merges the recorded events into the stored state, pruning the entries
+// older than the TTL, then the oldest ones beyond the maximum.
+func (d *deduplicator) save(now time.Time) error {
+	if len(d.recorded) == 0 {
+		return nil
+	}
+	expiry := now.Add(-d.ttl).Unix()
+	for attempt := 0; attempt < dedupSaveAttempts; attempt++ {
+		entries, version, err := d.store.load()
+		if err != nil {
+			return err
+		}
+		for key, t := range d.recorded {
+			entries[key] = t
+		}
+		for key, t := range entries {
+			if t < expiry {
+				delete(entries, key)
+			}
+		}
+		d.prune(entries)
+		err = d.store.save(entries, version)
+		if err == errDedupConflict {
+			continue
+		} else if err != nil {
+			return err
+		}
+		d.entries = entries
+		d.recorded = make(map[string]int64)
+		return nil
+	}
+	return fmt.Errorf("Failed to save deduplication state: %v", errDedupConflict)
+}
+
+// prune drops the oldest entries beyond the maximum. Their events may then be
+// forwarded again.
+func (d *deduplicator) prune(entries map[string]int64) {
+	if d.max <= 0 || len(entries) <= d.max {
+		return
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if entries[keys[i]] != entries[keys[j]] {
+			return entries[keys[i]] < entries[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	dropped := len(entries) - d.max
+	for _, key := range keys[:dropped] {
+		delete(entries, key)
+	}
+	logger.Warnf("Dropped the %d oldest deduplication record(s) beyond --dedup-max-entries %d", dropped, d.max)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func dedupEvent(uid string, count int32) k8scorev1.Event {
+	k8sev := k8scorev1.Event{}
+	k8sev.UID = types.UID(uid)
+	k8sev.Count = count
+	return k8sev
+}
+
+func TestDeduplicator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stores := map[string]func() dedupStore{
+		"memory": func() dedupStore { return &memoryDedupStore{} },
+		"file": func() dedupStore {
+			return fileDedupStore{path: filepath.Join(dir, "dedup.json")}
+		},
+		"configmap": func() dedupStore {
+			return configMapDedupStore{client: fake.NewSimpleClientset(), namespace: "monitoring", name: "dedup"}
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			store := newStore()
+			now := time.Now()
+
+			d := newDeduplicator(store, time.Hour, 100)
+			seen, err := d.seen(dedupEvent("a", 1))
+			require.NoError(t, err)
+			assert.False(seen)
+			d.record(dedupEvent("a", 1), now.Add(-2*time.Hour))
+			d.record(dedupEvent("b", 1), now)
+			require.NoError(t, d.save(now))
+
+			// Another run, possibly on another agent or replica
+			d = newDeduplicator(store, time.Hour, 100)
+			for _, tc := range []struct {
+				event k8scorev1.Event
+				seen  bool
+			}{
+				{dedupEvent("a", 1), false}, // pruned
+				{dedupEvent("b", 1), true},
+				{dedupEvent("b", 2), false}, // occurred again
+			} {
+				seen, err := d.seen(tc.event)
+				require.NoError(t, err)
+				assert.Equal(tc.seen, seen, dedupKey(tc.event))
+			}
+		})
+	}
+}
+
+func TestDeduplicatorMerge(t *testing.T) {
+	store := &memoryDedupStore{}
+	now := time.Now()
+
+	first := newDeduplicator(store, time.Hour, 100)
+	second := newDeduplicator(store, time.Hour, 100)
+	_, err := first.seen(dedupEvent("a", 1))
+	require.NoError(t, err)
+	_, err = second.seen(dedupEvent("a", 1))
+	require.NoError(t, err)
+
+	first.record(dedupEvent("a", 1), now)
+	second.record(dedupEvent("b", 1), now)
+	require.NoError(t, first.save(now))
+	require.NoError(t, second.save(now))
+
+	entries, _, err := store.load()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestDeduplicatorMaxEntries(t *testing.T) {
+	assert := assert.New(t)
+	store := &memoryDedupStore{}
+	now := time.Now()
+
+	d := newDeduplicator(store, time.Hour, 2)
+	d.record(dedupEvent("a", 1), now.Add(-2*time.Minute))
+	d.record(dedupEvent("b", 1), now.Add(-time.Minute))
+	d.record(dedupEvent("c", 1), now)
+	require.NoError(t, d.save(now))
+
+	// The oldest records are dropped
+	entries, _, err := store.load()
+	require.NoError(t, err)
+	assert.Len(entries, 2)
+	assert.NotContains(entries, "a/1")
+}
+
+func TestConfigMapDedupStoreTooLarge(t *testing.T) {
+	store := configMapDedupStore{client: fake.NewSimpleClientset(), namespace: "monitoring", name: "dedup"}
+	entries := map[string]int64{}
+	for i := 0; i < 1000; i++ {
+		entries[fmt.Sprintf("%d-%s", i, strings.Repeat("x", 1000))] = 0
+	}
+	err := store.save(entries, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lower --dedup-max-entries")
+}
+
+func TestDeduplicatorAggregatedEvents(t *testing.T) {
+	assert := assert.New(t)
+	base, baseDeduplicator, baseTTL := plugin, sharedDeduplicator, dedupTTL
+	defer func() {
+		plugin = base
+		sharedDeduplicator = baseDeduplicator
+		dedupTTL = baseTTL
+	}()
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.Aggregate = "namespace"
+	plugin.Dedup = "memory"
+	sharedDeduplicator = nil
+	dedupTTL = time.Hour
+	k8sev := dedupEvent("a", 1)
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+
+	// The aggregate fails to be delivered, the event isn't recorded
+	processor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	sink := &flakySink{down: true}
+	processor.sink = sink
+	_, err = processor.handle(k8sev)
+	require.NoError(t, err)
+	_, err = processor.flush()
+	assert.Error(err)
+	seen, err := sharedDeduplicator.seen(k8sev)
+	require.NoError(t, err)
+	assert.False(seen)
+
+	// Its retry is forwarded, then recorded
+	sink.down = false
+	processor, err = newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	processor.sink = sink
+	_, err = processor.handle(k8sev)
+	require.NoError(t, err)
+	_, err = processor.flush()
+	require.NoError(t, err)
+	assert.Equal([]string{"kubernetes-events"}, sink.delivered)
+	seen, err = sharedDeduplicator.seen(k8sev)
+	require.NoError(t, err)
+	assert.True(seen)
+}
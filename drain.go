@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// nodeDraining reports whether a node is being drained, i.e. it is cordoned
+// or carries one of the --drain-taints.
+func nodeDraining(node k8scorev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		for _, key := range plugin.DrainTaints {
+			if taint.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// drainingNodes returns the names of the nodes being drained.
+func drainingNodes(cache *objectCache) (map[string]bool, error) {
+	nodes, err := cache.listNodes()
+	if err != nil {
+		return nil, err
+	}
+	draining := make(map[string]bool)
+	for _, node := range nodes {
+		if nodeDraining(node) {
+			draining[node.Name] = true
+		}
+	}
+	return draining, nil
+}
+
+// drainChurn reports whether a Kubernetes event is expected churn caused by a
+// node drain: events of draining nodes, events of pods on draining nodes, and
+// pods failing to be scheduled while nodes are being drained.
+func drainChurn(k8sEvent k8scorev1.Event, cache *objectCache) (bool, error) {
+	draining, err := drainingNodes(cache)
+	if err != nil {
+		return false, err
+	}
+	if len(draining) == 0 {
+		return false, nil
+	}
+
+	switch strings.ToLower(k8sEvent.InvolvedObject.Kind) {
+	case "node":
+		return draining[k8sEvent.InvolvedObject.Name], nil
+	case "pod":
+		if k8sEvent.Reason == "FailedScheduling" {
+			// Evicted pods can't be scheduled while capacity is cordoned
+			return true, nil
+		}
+		_, namespace, _ := entityObject(k8sEvent)
+		pod, err := cache.getPod(namespace, k8sEvent.InvolvedObject.Name)
+		if err != nil {
+			return false, err
+		}
+		node := k8sEvent.Source.Host
+		if pod != nil && len(pod.Spec.NodeName) > 0 {
+			node = pod.Spec.NodeName
+		}
+		return draining[node], nil
+	}
+	return false, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeDraining(t *testing.T) {
+	assert := assert.New(t)
+	plugin.DrainTaints = []string{"node.kubernetes.io/unschedulable", "ToBeDeletedByClusterAutoscaler"}
+	node := k8scorev1.Node{}
+	assert.False(nodeDraining(node))
+	node.Spec.Unschedulable = true
+	assert.True(nodeDraining(node))
+	node.Spec.Unschedulable = false
+	node.Spec.Taints = []k8scorev1.Taint{{Key: "dedicated", Effect: k8scorev1.TaintEffectNoSchedule}}
+	assert.False(nodeDraining(node))
+	node.Spec.Taints = append(node.Spec.Taints, k8scorev1.Taint{Key: "ToBeDeletedByClusterAutoscaler", Effect: k8scorev1.TaintEffectNoSchedule})
+	assert.True(nodeDraining(node))
+}
+
+func TestDrainChurn(t *testing.T) {
+	plugin.DrainTaints = []string{"node.kubernetes.io/unschedulable"}
+	nodes := []k8scorev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: k8scorev1.NodeSpec{Unschedulable: true}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	}
+	pods := []k8scorev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default"}, Spec: k8scorev1.PodSpec{NodeName: "node-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "nginx-2", Namespace: "default"}, Spec: k8scorev1.PodSpec{NodeName: "node-2"}},
+	}
+	cache := newObjectCache(fake.NewSimpleClientset(&nodes[0], &nodes[1], &pods[0], &pods[1]))
+
+	testcases := []struct {
+		kind   string
+		name   string
+		reason string
+		host   string
+		churn  bool
+	}{
+		{"Node", "node-1", "NodeNotSchedulable", "", true},
+		{"Node", "node-2", "NodeNotReady", "", false},
+		{"Pod", "nginx-1", "Killing", "", true},
+		{"Pod", "nginx-2", "Killing", "", false},
+		{"Pod", "evicted-1", "Evicted", "node-1", true},
+		{"Pod", "evicted-2", "Evicted", "node-2", false},
+		{"Pod", "nginx-3", "FailedScheduling", "", true},
+		{"Deployment", "nginx", "ScalingReplicaSet", "", false},
+	}
+	for _, tc := range testcases {
+		k8sev := k8scorev1.Event{}
+		k8sev.ObjectMeta.Namespace = "default"
+		k8sev.InvolvedObject.Kind = tc.kind
+		k8sev.InvolvedObject.Name = tc.name
+		k8sev.Reason = tc.reason
+		k8sev.Source.Host = tc.host
+		churn, err := drainChurn(k8sev, cache)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.churn, churn, "%+v", tc)
+	}
+
+	// Nothing is churn when no node is being drained
+	cache = newObjectCache(fake.NewSimpleClientset(&nodes[1], &pods[1]))
+	k8sev := k8scorev1.Event{}
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-3"
+	k8sev.Reason = "FailedScheduling"
+	churn, err := drainChurn(k8sev, cache)
+	assert.NoError(t, err)
+	assert.False(t, churn)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// enrichPodEvent adds details from the live Pod object involved in a
+// Kubernetes event to the Sensu event. The node name and QoS class are added
+// as labels (so they can be used in filters), the container details are added
+// as annotations.
+func enrichPodEvent(event *corev2.Event, k8sEvent k8scorev1.Event, cache *objectCache) error {
+	if strings.ToLower(k8sEvent.InvolvedObject.Kind) != "pod" {
+		return nil
+	}
+
+	namespace := k8sEvent.InvolvedObject.Namespace
+	if len(namespace) == 0 {
+		namespace = k8sEvent.ObjectMeta.Namespace
+	}
+	pod, err := cache.getPod(namespace, k8sEvent.InvolvedObject.Name)
+	if err != nil {
+		return err
+	}
+	if pod == nil {
+		// The pod has been deleted since the event was recorded
+		return nil
+	}
+
+	if event.ObjectMeta.Labels == nil {
+		event.ObjectMeta.Labels = make(map[string]string)
+	}
+	if event.ObjectMeta.Annotations == nil {
+		event.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	if len(pod.Spec.NodeName) > 0 {
+		event.ObjectMeta.Labels["io.kubernetes.pod.node"] = pod.Spec.NodeName
+	}
+	if len(pod.Status.QOSClass) > 0 {
+		event.ObjectMeta.Labels["io.kubernetes.pod.qos_class"] = string(pod.Status.QOSClass)
+	}
+
+	// Use the container referenced by the event, or the only container in the
+	// pod if the event is about the pod itself.
+	container := containerName(k8sEvent.InvolvedObject.FieldPath)
+	if len(container) == 0 && len(pod.Spec.Containers) == 1 {
+		container = pod.Spec.Containers[0].Name
+	}
+	if len(container) == 0 {
+		return nil
+	}
+
+	// Container names are unique across the containers and init containers
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if c.Name == container {
+			event.ObjectMeta.Annotations["io.kubernetes.container.image"] = c.Image
+		}
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.Name != container {
+			continue
+		}
+		event.ObjectMeta.Annotations["io.kubernetes.container.name"] = status.Name
+		event.ObjectMeta.Annotations["io.kubernetes.container.restart_count"] = strconv.Itoa(int(status.RestartCount))
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			event.ObjectMeta.Annotations["io.kubernetes.container.last_terminated_reason"] = terminated.Reason
+			event.ObjectMeta.Annotations["io.kubernetes.container.last_terminated_exit_code"] = strconv.Itoa(int(terminated.ExitCode))
+		}
+	}
+
+	return nil
+}
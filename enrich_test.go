@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestContainerName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("nginx", containerName("spec.containers{nginx}"))
+	assert.Equal("init", containerName("spec.initContainers{init}"))
+	assert.Equal("", containerName("metadata.name"))
+	assert.Equal("", containerName(""))
+	assert.Equal("", containerName("spec.containers"))
+}
+
+func TestEnrichPodEvent(t *testing.T) {
+	assert := assert.New(t)
+	pod := &k8scorev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default"},
+		Spec: k8scorev1.PodSpec{
+			NodeName:       "node-1",
+			InitContainers: []k8scorev1.Container{{Name: "migrate", Image: "flyway:7"}},
+			Containers: []k8scorev1.Container{
+				{Name: "nginx", Image: "nginx:1.19"},
+				{Name: "sidecar", Image: "envoy:1.15"},
+			},
+		},
+		Status: k8scorev1.PodStatus{
+			QOSClass: k8scorev1.PodQOSBurstable,
+			ContainerStatuses: []k8scorev1.ContainerStatus{
+				{
+					Name:         "nginx",
+					RestartCount: 4,
+					LastTerminationState: k8scorev1.ContainerState{
+						Terminated: &k8scorev1.ContainerStateTerminated{
+							Reason:   "OOMKilled",
+							ExitCode: 137,
+						},
+					},
+				},
+			},
+		},
+	}
+	cache := newObjectCache(fake.NewSimpleClientset(pod))
+
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	k8sev.InvolvedObject.FieldPath = "spec.containers{nginx}"
+
+	event := &corev2.Event{}
+	assert.NoError(enrichPodEvent(event, k8sev, cache))
+	assert.Equal("node-1", event.ObjectMeta.Labels["io.kubernetes.pod.node"])
+	assert.Equal("Burstable", event.ObjectMeta.Labels["io.kubernetes.pod.qos_class"])
+	assert.Equal("nginx:1.19", event.ObjectMeta.Annotations["io.kubernetes.container.image"])
+	assert.Equal("4", event.ObjectMeta.Annotations["io.kubernetes.container.restart_count"])
+	assert.Equal("OOMKilled", event.ObjectMeta.Annotations["io.kubernetes.container.last_terminated_reason"])
+	assert.Equal("137", event.ObjectMeta.Annotations["io.kubernetes.container.last_terminated_exit_code"])
+
+	// Init containers are looked up as well
+	k8sev.InvolvedObject.FieldPath = "spec.initContainers{migrate}"
+	event = &corev2.Event{}
+	assert.NoError(enrichPodEvent(event, k8sev, cache))
+	assert.Equal("flyway:7", event.ObjectMeta.Annotations["io.kubernetes.container.image"])
+
+	// Pod events for multi-container pods don't get container details
+	k8sev.InvolvedObject.FieldPath = ""
+	event = &corev2.Event{}
+	assert.NoError(enrichPodEvent(event, k8sev, cache))
+	assert.Equal("node-1", event.ObjectMeta.Labels["io.kubernetes.pod.node"])
+	assert.Empty(event.ObjectMeta.Annotations["io.kubernetes.container.image"])
+
+	// Deleted pods are skipped
+	k8sev.InvolvedObject.Name = "nginx-2"
+	event = &corev2.Event{}
+	assert.NoError(enrichPodEvent(event, k8sev, cache))
+	assert.Empty(event.ObjectMeta.Labels)
+
+	// Other kinds are ignored
+	k8sev.InvolvedObject.Kind = "Node"
+	event = &corev2.Event{}
+	assert.NoError(enrichPodEvent(event, k8sev, cache))
+	assert.Empty(event.ObjectMeta.Labels)
+}
+
+func TestProcessLookupFailures(t *testing.T) {
+	assert := assert.New(t)
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.SensuNamespace = "default"
+	plugin.EnrichPods = true
+	plugin.CopyLabels = []string{"app"}
+	plugin.SensuNamespaceLabel = "sensu.io/namespace"
+	plugin.SilenceAction = "skip"
+	plugin.SilenceAnnotation = "sensu.io/silence-until"
+	plugin.DrainAction = "skip"
+
+	// The service account may not be allowed to look objects up
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		resource := action.GetResource()
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Group: resource.Group, Resource: resource.Resource}, "", nil)
+	})
+	processor, err := newEventProcessor(clientset)
+	require.NoError(t, err)
+
+	k8sev := k8scorev1.Event{}
+	k8sev.Name = "nginx.1"
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx"
+	k8sev.InvolvedObject.FieldPath = "spec.containers{nginx}"
+	event, err := processor.process(k8sev)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal("default", event.ObjectMeta.Namespace)
+	assert.Empty(event.ObjectMeta.Labels["io.kubernetes.pod.node"])
+}
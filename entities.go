@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// managedByLabel identifies the proxy entities upserted by this plugin
+	managedByLabel = "sensu.io/managed_by"
+	managedByValue = "sensu-kubernetes-events"
+)
+
+// entityObject returns the kind, namespace and name of the Kubernetes object
+// represented by the proxy entity of a Sensu event created for a Kubernetes
+// event. See the "Sensu Entity" section of createSensuEvent.
+func entityObject(k8sEvent k8scorev1.Event) (string, string, string) {
+	namespace := k8sEvent.InvolvedObject.Namespace
+	if len(namespace) == 0 {
+		namespace = k8sEvent.ObjectMeta.Namespace
+	}
+	if strings.ToLower(k8sEvent.InvolvedObject.Kind) == "replicaset" {
+		// Replicaset/Pod events are associated with the Pod
+		message := strings.Split(k8sEvent.Message, "pod:")
+		if len(message) == 2 && len(strings.Fields(message[1])) > 0 {
+			return "Pod", namespace, strings.Fields(message[1])[0]
+		}
+	}
+	if strings.ToLower(k8sEvent.InvolvedObject.Kind) == "node" {
+		namespace = ""
+	}
+	return k8sEvent.InvolvedObject.Kind, namespace, k8sEvent.InvolvedObject.Name
+}
+
+// entityReference returns a reference to the Kubernetes object represented by
+// the proxy entity of the Sensu event created for a Kubernetes event.
+func entityReference(k8sEvent k8scorev1.Event) k8scorev1.ObjectReference {
+	kind, namespace, name := entityObject(k8sEvent)
+	return k8scorev1.ObjectReference{Kind: kind, Namespace: namespace, Name: name}
+}
+
+// proxyEntity returns the proxy entity of a Sensu event about a Kubernetes
+// object, labeled so that Sensu filters and silencing can tell apart the
+// different kinds of Kubernetes objects.
+func proxyEntity(event *corev2.Event, object k8scorev1.ObjectReference) *corev2.Entity {
+	kind, namespace, name := object.Kind, object.Namespace, object.Name
+
+	labels := map[string]string{
+		managedByLabel:       managedByValue,
+		"io.kubernetes.kind": kind,
+	}
+	if len(name) > 0 {
+		labels["io.kubernetes.object.name"] = name
+	}
+	if len(namespace) > 0 {
+		labels["io.kubernetes.namespace"] = namespace
+	}
+	if len(plugin.Cluster) > 0 {
+		labels["io.kubernetes.cluster"] = plugin.Cluster
+	}
+	if strings.ToLower(kind) == "node" {
+		labels["io.kubernetes.node"] = name
+	} else if node, ok := event.ObjectMeta.Labels["io.kubernetes.pod.node"]; ok {
+		labels["io.kubernetes.node"] = node
+	}
+
+	entityName := event.Check.ProxyEntityName
+	subscriptions := []string{fmt.Sprintf("entity:%s", entityName)}
+	subscriptions = append(subscriptions, plugin.EntitySubscriptions...)
+
+	entityNamespace := event.ObjectMeta.Namespace
+	if len(entityNamespace) == 0 {
+		entityNamespace = plugin.SensuNamespace
+	}
+	entity := corev2.NewEntity(corev2.ObjectMeta{
+		Name:      entityName,
+		Namespace: entityNamespace,
+		Labels:    labels,
+	})
+	entity.EntityClass = corev2.EntityProxyClass
+	entity.Subscriptions = subscriptions
+	return entity
+}
+
+// entityUpserter upserts the proxy entities of Sensu events through the
+// backend API, once per entity per check run, including the entities of the
+// workloads, namespaces and cluster of summary events. Missing entities are created,
+// and only those carrying the managedByLabel are updated: an entity named
+// like the object may be an agent entity (e.g. of a node), or one managed by
+// other means.
+type entityUpserter struct {
+	client   *sensuAPIClient
+	upserted map[string]bool
+}
+
+func newEntityUpserter(client *sensuAPIClient) *entityUpserter {
+	return &entityUpserter{
+		client:   client,
+		upserted: make(map[string]bool),
+	}
+}
+
+// upsert upserts the proxy entity of a Sensu event about a Kubernetes object.
+func (u *entityUpserter) upsert(event *corev2.Event, object k8scorev1.ObjectReference) error {
+	entity := proxyEntity(event, object)
+	key := fmt.Sprintf("%s/%s", entity.Namespace, entity.Name)
+	if u.upserted[key] {
+		return nil
+	}
+
+	existing := &corev2.Entity{}
+	err := u.client.do("GET", entity.URIPath(), nil, existing)
+	if apiErr, ok := err.(sensuAPIStatusError); ok && apiErr.status == http.StatusNotFound {
+		existing = nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to get entity %s: %v", key, err)
+	}
+
+	if existing != nil {
+		if existing.Labels[managedByLabel] != managedByValue {
+			pipelineLog().WithField("entity", key).Debug("Entity not upserted: not managed by the plugin")
+			u.upserted[key] = true
+			return nil
+		}
+		if !mergeEntity(existing, entity) {
+			u.upserted[key] = true
+			return nil
+		}
+		entity = existing
+	}
+	if err := u.client.do("PUT", entity.URIPath(), entity, nil); err != nil {
+		return fmt.Errorf("Failed to upsert entity %s: %v", key, err)
+	}
+	u.upserted[key] = true
+	return nil
+}
+
+// mergeEntity merges the labels and subscriptions of the proxy entity into an
+// existing entity, keeping the labels and subscriptions added by users. It
+// reports whether the existing entity changed.
+func mergeEntity(existing, entity *corev2.Entity) bool {
+	changed := false
+	if existing.Labels == nil {
+		existing.Labels = make(map[string]string)
+	}
+	for key, value := range entity.Labels {
+		if current, ok := existing.Labels[key]; !ok || current != value {
+			existing.Labels[key] = value
+			changed = true
+		}
+	}
+	for _, subscription := range entity.Subscriptions {
+		found := false
+		for _, current := range existing.Subscriptions {
+			if current == subscription {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing.Subscriptions = append(existing.Subscriptions, subscription)
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEntityObject(t *testing.T) {
+	assert := assert.New(t)
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "ReplicaSet"
+	k8sev.InvolvedObject.Name = "nginx-bbd465f66"
+	k8sev.Message = "Created pod: nginx-bbd465f66-rwb2d"
+	kind, namespace, name := entityObject(k8sev)
+	assert.Equal("Pod", kind)
+	assert.Equal("default", namespace)
+	assert.Equal("nginx-bbd465f66-rwb2d", name)
+
+	k8sev.Message = "Scaled down"
+	kind, _, name = entityObject(k8sev)
+	assert.Equal("ReplicaSet", kind)
+	assert.Equal("nginx-bbd465f66", name)
+
+	k8sev.InvolvedObject.Kind = "Node"
+	k8sev.InvolvedObject.Name = "node-1"
+	kind, namespace, name = entityObject(k8sev)
+	assert.Equal("Node", kind)
+	assert.Equal("", namespace)
+	assert.Equal("node-1", name)
+}
+
+func TestEntityUpserter(t *testing.T) {
+	assert := assert.New(t)
+	entities := map[string]*corev2.Entity{}
+	puts := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("Key abc123", r.Header.Get("Authorization"))
+		switch r.Method {
+		case "GET":
+			entity, ok := entities[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(entity))
+		case "PUT":
+			puts++
+			entity := &corev2.Entity{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(entity))
+			entities[r.URL.Path] = entity
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer test.Close()
+
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.SensuAPIURL = test.URL
+	plugin.SensuAPIKey = "abc123"
+	plugin.SensuNamespace = "sensu-ns"
+	plugin.Cluster = "prod-eu"
+	plugin.EntitySubscriptions = []string{"kubernetes"}
+
+	client, err := newSensuAPIClient()
+	require.NoError(t, err)
+
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	event := &corev2.Event{Check: &corev2.Check{ProxyEntityName: "nginx-1"}}
+	event.ObjectMeta.Labels = map[string]string{"io.kubernetes.pod.node": "node-1"}
+
+	// Missing entities are created, once per run
+	upserter := newEntityUpserter(client)
+	assert.NoError(upserter.upsert(event, entityReference(k8sev)))
+	assert.NoError(upserter.upsert(event, entityReference(k8sev)))
+	assert.Equal(1, puts)
+	entity := entities["/api/core/v2/namespaces/sensu-ns/entities/nginx-1"]
+	require.NotNil(t, entity)
+	assert.Equal("proxy", entity.EntityClass)
+	assert.Equal([]string{"entity:nginx-1", "kubernetes"}, entity.Subscriptions)
+	assert.Equal(map[string]string{
+		"sensu.io/managed_by":       "sensu-kubernetes-events",
+		"io.kubernetes.kind":        "Pod",
+		"io.kubernetes.object.name": "nginx-1",
+		"io.kubernetes.namespace":   "default",
+		"io.kubernetes.cluster":     "prod-eu",
+		"io.kubernetes.node":        "node-1",
+	}, entity.Labels)
+
+	// Unchanged entities are left alone, labels added by users are kept
+	assert.NoError(newEntityUpserter(client).upsert(event, entityReference(k8sev)))
+	assert.Equal(1, puts)
+	entity.Labels["team"] = "web"
+	event.ObjectMeta.Labels["io.kubernetes.pod.node"] = "node-2"
+	assert.NoError(newEntityUpserter(client).upsert(event, entityReference(k8sev)))
+	assert.Equal(2, puts)
+	entity = entities["/api/core/v2/namespaces/sensu-ns/entities/nginx-1"]
+	assert.Equal("web", entity.Labels["team"])
+	assert.Equal("node-2", entity.Labels["io.kubernetes.node"])
+
+	// Entities the plugin doesn't manage, e.g. of the agent on a node, are
+	// never updated
+	agent := corev2.FixtureEntity("node-1")
+	agent.Namespace = "sensu-ns"
+	agent.EntityClass = corev2.EntityAgentClass
+	entities[agent.URIPath()] = agent
+	k8sev.InvolvedObject.Kind = "Node"
+	k8sev.InvolvedObject.Name = "node-1"
+	event = &corev2.Event{Check: &corev2.Check{ProxyEntityName: "node-1"}}
+	assert.NoError(newEntityUpserter(client).upsert(event, entityReference(k8sev)))
+	assert.Equal(2, puts)
+	assert.Equal("agent", entities[agent.URIPath()].EntityClass)
+}
+
+func TestEntityUpserterError(t *testing.T) {
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer test.Close()
+	plugin.SensuAPIURL = test.URL
+	defer func() { plugin.SensuAPIURL = "" }()
+
+	client, err := newSensuAPIClient()
+	require.NoError(t, err)
+	k8sev := k8scorev1.Event{}
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	event := &corev2.Event{Check: &corev2.Check{ProxyEntityName: "nginx-1"}}
+	assert.Error(t, newEntityUpserter(client).upsert(event, entityReference(k8sev)))
+}
+
+func TestProcessUpsertFailure(t *testing.T) {
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer test.Close()
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.SensuAPIURL = test.URL
+	plugin.UpsertEntities = true
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+
+	processor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	sink := &flakySink{}
+	processor.sink = sink
+
+	// Upserting only adds to the entity, the event is still sent
+	k8sev := k8scorev1.Event{}
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	summary, err := processor.handle(k8sev)
+	require.NoError(t, err)
+	assert.NotEmpty(t, summary)
+	assert.Equal(t, []string{"pod-backoff"}, sink.delivered)
+}
+
+func TestProcessUpsertSummaryEntities(t *testing.T) {
+	assert := assert.New(t)
+	entities := map[string]*corev2.Entity{}
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusNotFound)
+		case "PUT":
+			entity := &corev2.Entity{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(entity))
+			entities[entity.Name] = entity
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer test.Close()
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.SensuAPIURL = test.URL
+	plugin.SensuNamespace = "default"
+	plugin.UpsertEntities = true
+	plugin.Aggregate = "namespace"
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+
+	processor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	sink := &flakySink{}
+	processor.sink = sink
+	k8sev := k8scorev1.Event{}
+	k8sev.Namespace = "web"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	k8sev.InvolvedObject.Namespace = "web"
+	_, err = processor.handle(k8sev)
+	require.NoError(t, err)
+	_, err = processor.flush()
+	require.NoError(t, err)
+
+	// The summary is sent for the labeled entity of the namespace
+	assert.Equal([]string{"kubernetes-events"}, sink.delivered)
+	entity := entities["web-namespace"]
+	require.NotNil(t, entity)
+	assert.Equal("proxy", entity.EntityClass)
+	assert.Equal("Namespace", entity.Labels["io.kubernetes.kind"])
+	assert.Equal("web", entity.Labels["io.kubernetes.object.name"])
+}
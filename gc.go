@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// missingSinceAnnotation records when the Kubernetes object of a managed
+	// proxy entity was first found to be missing
+	missingSinceAnnotation = "io.kubernetes.missing_since"
+
+	// deletedLabel marks managed proxy entities whose Kubernetes object was
+	// deleted, when using --gc-action mark
+	deletedLabel = "io.kubernetes.deleted"
+)
+
+// collectEntities looks for the proxy entities created by this plugin whose
+// Kubernetes object no longer exists, and deletes (or marks) those that have
+// been missing for longer than the grace period, in the given Sensu namespace.
+// It returns a description of each entity that was collected.
+func collectEntities(client *sensuAPIClient, cache *objectCache, namespace string, gracePeriod time.Duration, now time.Time) ([]string, error) {
+	entities, err := client.listEntities(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list entities: %v", err)
+	}
+
+	collected := []string{}
+	for _, entity := range entities {
+		if entity.Labels[managedByLabel] != managedByValue {
+			continue
+		}
+		// Never touch entities of other clusters sharing the Sensu namespace
+		if entity.Labels["io.kubernetes.cluster"] != plugin.Cluster {
+			continue
+		}
+		if entity.Labels[deletedLabel] == "true" {
+			continue
+		}
+
+		ref := k8scorev1.ObjectReference{
+			Kind:      entity.Labels["io.kubernetes.kind"],
+			Namespace: entity.Labels["io.kubernetes.namespace"],
+			Name:      entity.Labels["io.kubernetes.object.name"],
+		}
+		meta, err := cache.getObjectMeta(ref, "")
+		if err == errUnsupportedKind {
+			continue
+		} else if err != nil {
+			return collected, err
+		}
+
+		if meta != nil {
+			// The object exists (again), clear any previous missing mark
+			if _, ok := entity.Annotations[missingSinceAnnotation]; ok {
+				delete(entity.Annotations, missingSinceAnnotation)
+				if err := client.do("PUT", entity.URIPath(), entity, nil); err != nil {
+					return collected, fmt.Errorf("Failed to update entity %s: %v", entity.Name, err)
+				}
+			}
+			continue
+		}
+
+		missingSince, err := time.Parse(time.RFC3339, entity.Annotations[missingSinceAnnotation])
+		if err != nil {
+			// First time the object is found missing, start the grace period
+			if entity.Annotations == nil {
+				entity.Annotations = make(map[string]string)
+			}
+			entity.Annotations[missingSinceAnnotation] = now.UTC().Format(time.RFC3339)
+			if err := client.do("PUT", entity.URIPath(), entity, nil); err != nil {
+				return collected, fmt.Errorf("Failed to update entity %s: %v", entity.Name, err)
+			}
+			continue
+		}
+		if now.Sub(missingSince) < gracePeriod {
+			continue
+		}
+
+		description := fmt.Sprintf("%s (%s %s missing since %s)", entity.Name, ref.Kind, objectKey(ref), missingSince.Format(time.RFC3339))
+		switch plugin.GCAction {
+		case "mark":
+			entity.Labels[deletedLabel] = "true"
+			if err := client.do("PUT", entity.URIPath(), entity, nil); err != nil {
+				return collected, fmt.Errorf("Failed to mark entity %s: %v", entity.Name, err)
+			}
+			collected = append(collected, fmt.Sprintf("Marked stale entity %s", description))
+		default:
+			if err := client.do("DELETE", entity.URIPath(), nil, nil); err != nil {
+				return collected, fmt.Errorf("Failed to delete entity %s: %v", entity.Name, err)
+			}
+			collected = append(collected, fmt.Sprintf("Deleted stale entity %s", description))
+		}
+	}
+
+	return collected, nil
+}
+
+// objectKey returns the namespace/name key of a Kubernetes object reference,
+// or only its name for objects that aren't namespaced.
+func objectKey(ref k8scorev1.ObjectReference) string {
+	if len(ref.Namespace) == 0 {
+		return ref.Name
+	}
+	return fmt.Sprintf("%s/%s", ref.Namespace, ref.Name)
+}
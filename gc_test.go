@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func managedEntity(name, kind, namespace string, annotations map[string]string) *corev2.Entity {
+	labels := map[string]string{
+		managedByLabel:              managedByValue,
+		"io.kubernetes.kind":        kind,
+		"io.kubernetes.object.name": name,
+	}
+	if len(namespace) > 0 {
+		labels["io.kubernetes.namespace"] = namespace
+	}
+	entity := corev2.NewEntity(corev2.ObjectMeta{
+		Name:        name,
+		Namespace:   "default",
+		Labels:      labels,
+		Annotations: annotations,
+	})
+	entity.EntityClass = corev2.EntityProxyClass
+	return entity
+}
+
+func TestCollectEntities(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	longAgo := map[string]string{missingSinceAnnotation: now.Add(-2 * time.Hour).Format(time.RFC3339)}
+	recently := map[string]string{missingSinceAnnotation: now.Add(-10 * time.Minute).Format(time.RFC3339)}
+
+	entities := []*corev2.Entity{
+		// still exists
+		managedEntity("nginx-1", "Pod", "default", nil),
+		// exists again, missing mark should be cleared
+		managedEntity("node-1", "Node", "", longAgo),
+		// missing for the first time
+		managedEntity("nginx-2", "Pod", "default", nil),
+		// missing within the grace period
+		managedEntity("nginx-3", "Pod", "default", recently),
+		// missing for longer than the grace period
+		managedEntity("nginx-4", "Pod", "default", longAgo),
+		// unsupported kinds are left alone
+		managedEntity("widget-1", "Widget", "default", longAgo),
+		// not managed by this plugin
+		corev2.FixtureEntity("agent-1"),
+	}
+	pages := [][]*corev2.Entity{entities[:4], entities[4:]}
+
+	testcases := []struct {
+		action  string
+		updated []string
+		deleted []string
+		output  []string
+	}{
+		{"delete", []string{"node-1", "nginx-2"}, []string{"nginx-4"}, []string{"Deleted stale entity nginx-4 (Pod default/nginx-4 missing since 2020-06-01T10:00:00Z)"}},
+		{"mark", []string{"node-1", "nginx-2", "nginx-4"}, []string{}, []string{"Marked stale entity nginx-4 (Pod default/nginx-4 missing since 2020-06-01T10:00:00Z)"}},
+	}
+
+	for _, tc := range testcases {
+		assert := assert.New(t)
+		updated := []string{}
+		deleted := []string{}
+		var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET":
+				assert.Equal("/api/core/v2/namespaces/default/entities", r.URL.Path)
+				page := pages[0]
+				if r.URL.Query().Get("continue") == "page2" {
+					page = pages[1]
+				} else {
+					w.Header().Set("Sensu-Continue", "page2")
+				}
+				require.NoError(t, json.NewEncoder(w).Encode(page))
+			case "PUT":
+				entity := &corev2.Entity{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(entity))
+				switch entity.Name {
+				case "node-1":
+					assert.Empty(entity.Annotations[missingSinceAnnotation])
+				case "nginx-2":
+					assert.Equal("2020-06-01T12:00:00Z", entity.Annotations[missingSinceAnnotation])
+				case "nginx-4":
+					assert.Equal("true", entity.Labels[deletedLabel])
+				}
+				updated = append(updated, entity.Name)
+			case "DELETE":
+				deleted = append(deleted, r.URL.Path[len("/api/core/v2/namespaces/default/entities/"):])
+			}
+		}))
+
+		plugin.SensuAPIURL = test.URL
+		plugin.GCAction = tc.action
+		client, err := newSensuAPIClient()
+		require.NoError(t, err)
+		cache := newObjectCache(fake.NewSimpleClientset(
+			&k8scorev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default"}},
+			&k8scorev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		))
+
+		collected, err := collectEntities(client, cache, "default", time.Hour, now)
+		assert.NoError(err)
+		assert.Equal(tc.output, collected)
+		assert.Equal(tc.updated, updated)
+		assert.Equal(tc.deleted, deleted)
+		test.Close()
+	}
+	plugin.SensuAPIURL = ""
+	plugin.GCAction = ""
+}
+
+func TestCollectEntitiesOtherCluster(t *testing.T) {
+	entity := managedEntity("nginx-1", "Pod", "default", map[string]string{missingSinceAnnotation: "2000-01-01T00:00:00Z"})
+	entity.Labels["io.kubernetes.cluster"] = "other"
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		require.NoError(t, json.NewEncoder(w).Encode([]*corev2.Entity{entity}))
+	}))
+	defer test.Close()
+
+	plugin.SensuAPIURL = test.URL
+	plugin.Cluster = "prod-eu"
+	defer func() {
+		plugin.SensuAPIURL = ""
+		plugin.Cluster = ""
+	}()
+	client, err := newSensuAPIClient()
+	require.NoError(t, err)
+	collected, err := collectEntities(client, newObjectCache(fake.NewSimpleClientset()), "default", time.Hour, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, collected)
+}
@@ -8,8 +8,10 @@ require (
 	github.com/sensu-community/sensu-plugin-sdk v0.8.1
 	github.com/sensu/sensu-go/api/core/v2 v2.2.3
 	github.com/sensu/sensu-go/types v0.3.0
+	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.6.0
 	k8s.io/api v0.18.0
 	k8s.io/apimachinery v0.18.0
 	k8s.io/client-go v0.18.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// handlerRoute selects the handlers of the events matching all of its
+// (non-empty) criteria.
+type handlerRoute struct {
+	// Namespace is the Kubernetes namespace, exact or glob (e.g. "team-*")
+	Namespace string `json:"namespace"`
+	// Kind is the kind of the involved object, case-insensitive
+	Kind string `json:"kind"`
+	// Reason is a regular expression matched against the event reason
+	Reason string `json:"reason"`
+	// Labels are label values the Sensu event must have
+	Labels map[string]string `json:"labels"`
+	// Status is the status the Sensu event must have
+	Status *uint32 `json:"status"`
+	// Handlers are the handlers of the matching events
+	Handlers []string `json:"handlers"`
+
+	reason *regexp.Regexp
+}
+
+// handlerRoutes is the parsed --handler-routes
+var handlerRoutes []handlerRoute
+
+// parseHandlerRoutes parses a JSON list of handler routes.
+func parseHandlerRoutes(text string) ([]handlerRoute, error) {
+	routes := []handlerRoute{}
+	if len(text) == 0 {
+		return routes, nil
+	}
+	if err := json.Unmarshal([]byte(text), &routes); err != nil {
+		return nil, fmt.Errorf("Failed to parse --handler-routes: %v", err)
+	}
+	for i := range routes {
+		if len(routes[i].Reason) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(routes[i].Reason)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse reason of handler route %d: %v", i, err)
+		}
+		routes[i].reason = re
+	}
+	return routes, nil
+}
+
+func (r handlerRoute) matches(event *corev2.Event, k8sEvent k8scorev1.Event) bool {
+	if len(r.Namespace) > 0 {
+		namespace := k8sEvent.InvolvedObject.Namespace
+		if len(namespace) == 0 {
+			namespace = k8sEvent.ObjectMeta.Namespace
+		}
+		if !matchKey(r.Namespace, namespace) {
+			return false
+		}
+	}
+	if len(r.Kind) > 0 && !strings.EqualFold(r.Kind, k8sEvent.InvolvedObject.Kind) {
+		return false
+	}
+	if r.reason != nil && !r.reason.MatchString(k8sEvent.Reason) {
+		return false
+	}
+	for key, value := range r.Labels {
+		if event.ObjectMeta.Labels[key] != value {
+			return false
+		}
+	}
+	if r.Status != nil && *r.Status != event.Check.Status {
+		return false
+	}
+	return true
+}
+
+// routeHandlers sets the handlers of the event created for a Kubernetes event
+// to those of the first matching handler route. Events that don't match any
+// route keep the handlers of the check.
+func routeHandlers(event *corev2.Event, k8sEvent k8scorev1.Event) {
+	for i, route := range handlerRoutes {
+		if route.matches(event, k8sEvent) {
+			eventLog(k8sEvent).WithField("route", i).Debug("Handlers routed")
+			event.Check.Handlers = route.Handlers
+			return
+		}
+	}
+}
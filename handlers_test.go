@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func TestParseHandlerRoutes(t *testing.T) {
+	assert := assert.New(t)
+	routes, err := parseHandlerRoutes("")
+	assert.NoError(err)
+	assert.Empty(routes)
+	routes, err = parseHandlerRoutes(`[{"reason": "^(BackOff|Failed)$", "handlers": ["slack"]}]`)
+	assert.NoError(err)
+	assert.Len(routes, 1)
+	assert.NotNil(routes[0].reason)
+	_, err = parseHandlerRoutes(`[{"reason": "(", "handlers": ["slack"]}]`)
+	assert.Error(err)
+	_, err = parseHandlerRoutes(`{"handlers": ["slack"]}`)
+	assert.Error(err)
+}
+
+func TestRouteHandlers(t *testing.T) {
+	var err error
+	handlerRoutes, err = parseHandlerRoutes(`[
+		{"namespace": "kube-system", "kind": "node", "handlers": ["pagerduty"]},
+		{"status": 2, "handlers": ["pagerduty", "slack"]},
+		{"labels": {"team": "web"}, "handlers": ["slack-web"]},
+		{"namespace": "team-*", "reason": "^Failed", "handlers": ["slack-teams"]}
+	]`)
+	require.NoError(t, err)
+	defer func() { handlerRoutes = nil }()
+
+	testcases := []struct {
+		namespace string
+		kind      string
+		reason    string
+		labels    map[string]string
+		status    uint32
+		handlers  []string
+	}{
+		{"kube-system", "Node", "NodeNotReady", nil, 1, []string{"pagerduty"}},
+		{"kube-system", "Pod", "BackOff", nil, 1, []string{"default"}},
+		{"kube-system", "Pod", "BackOff", nil, 2, []string{"pagerduty", "slack"}},
+		{"shop", "Pod", "BackOff", map[string]string{"team": "web"}, 1, []string{"slack-web"}},
+		{"shop", "Pod", "BackOff", map[string]string{"team": "db"}, 1, []string{"default"}},
+		{"team-a", "Pod", "FailedMount", nil, 1, []string{"slack-teams"}},
+		{"team-a", "Pod", "BackOff", nil, 1, []string{"default"}},
+	}
+	for _, tc := range testcases {
+		k8sev := k8scorev1.Event{}
+		k8sev.ObjectMeta.Namespace = tc.namespace
+		k8sev.InvolvedObject.Kind = tc.kind
+		k8sev.Reason = tc.reason
+		event := &corev2.Event{Check: &corev2.Check{Status: tc.status, Handlers: []string{"default"}}}
+		event.ObjectMeta.Labels = tc.labels
+		routeHandlers(event, k8sev)
+		assert.Equal(t, tc.handlers, event.Check.Handlers, "%+v", tc)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// leaderElectLeaseDuration is the parsed --leader-elect-lease-duration
+var leaderElectLeaseDuration time.Duration
+
+// serviceAccountNamespaceFile holds the namespace of the pod running in a
+// cluster.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// leaderElectionNamespace returns the namespace of the leader election Lease,
+// defaulting to the namespace of the pod.
+func leaderElectionNamespace() string {
+	if len(plugin.LeaderElectNamespace) > 0 {
+		return plugin.LeaderElectNamespace
+	}
+	if namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(namespace))
+	}
+	return "default"
+}
+
+// leaderElectionIdentity returns the identity of this replica in the leader
+// election, defaulting to the hostname (the pod name in a cluster).
+func leaderElectionIdentity() (string, error) {
+	if len(plugin.LeaderElectIdentity) > 0 {
+		return plugin.LeaderElectIdentity, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get hostname for the leader election identity: %v", err)
+	}
+	return hostname, nil
+}
+
+// runLeaderElection runs a function only while this replica holds the
+// --leader-elect-lease, so that a single replica processes events. It returns
+// when the function fails or when the lease is lost, for the replica to be
+// restarted, or on shutdown.
+func runLeaderElection(clientset kubernetes.Interface, run func(stop <-chan struct{}) error) error {
+	identity, err := leaderElectionIdentity()
+	if err != nil {
+		return err
+	}
+	// The callbacks run concurrently with the processing of events, which
+	// activates the settings of each pipeline
+	namespace := leaderElectionNamespace()
+	name := plugin.LeaderElectLease
+	duration := leaderElectLeaseDuration
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	// Standby replicas are ready, they only wait for the lease
+	telemetry.setLeader(identity, false)
+	telemetry.setReady(true)
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(intakeContext)
+	defer cancel()
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   duration,
+		RenewDeadline:   duration * 2 / 3,
+		RetryPeriod:     duration / 6,
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Infof("Started leading lease %s/%s as %s", namespace, name, identity)
+				telemetry.setLeader(identity, true)
+				close(started)
+				done <- run(ctx.Done())
+				// Release the lease for another replica to take over
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				logger.Infof("Stopped leading lease %s/%s as %s", namespace, name, identity)
+				telemetry.setLeader(identity, false)
+			},
+			OnNewLeader: func(leader string) {
+				logger.Infof("Leader of lease %s/%s is %s", namespace, name, leader)
+			},
+		},
+	})
+
+	select {
+	case <-started:
+		if err := <-done; err != nil {
+			return err
+		}
+	default:
+	}
+	if shuttingDown() {
+		return nil
+	}
+	return fmt.Errorf("Lost lease %s/%s", namespace, name)
+}
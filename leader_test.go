@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunLeaderElection(t *testing.T) {
+	base, baseDuration := plugin, leaderElectLeaseDuration
+	defer func() {
+		// Only once the elector stopped, see below
+		plugin = base
+		leaderElectLeaseDuration = baseDuration
+		telemetry.setLeader("", false)
+	}()
+	plugin.LeaderElectLease = "sensu-kubernetes-events"
+	plugin.LeaderElectNamespace = "monitoring"
+	plugin.LeaderElectIdentity = "replica-1"
+	leaderElectLeaseDuration = time.Second
+
+	clientset := fake.NewSimpleClientset()
+	failed := errors.New("watch failed")
+	err := runLeaderElection(clientset, func(stop <-chan struct{}) error {
+		lease, err := clientset.CoordinationV1().Leases("monitoring").Get(context.TODO(), "sensu-kubernetes-events", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "replica-1", *lease.Spec.HolderIdentity)
+		assert.True(t, telemetry.leader)
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	assert.False(t, telemetry.leader)
+
+	// The elector stopped, releasing the lease
+	lease, err := clientset.CoordinationV1().Leases("monitoring").Get(context.TODO(), "sensu-kubernetes-events", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, *lease.Spec.HolderIdentity)
+}
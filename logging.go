@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// logger logs to STDERR, as the STDOUT of check runs is the check output.
+var logger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.TextFormatter{},
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.InfoLevel,
+}
+
+// configureLogging configures the logger from --log-level and --log-format.
+func configureLogging() error {
+	level := logrus.InfoLevel
+	if len(plugin.LogLevel) > 0 {
+		var err error
+		level, err = logrus.ParseLevel(plugin.LogLevel)
+		if err != nil {
+			return fmt.Errorf("invalid --log-level %q, must be trace, debug, info, warning, error, fatal or panic", plugin.LogLevel)
+		}
+	}
+	logger.SetLevel(level)
+
+	switch plugin.LogFormat {
+	case "", "text":
+		logger.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid --log-format %q, must be text or json", plugin.LogFormat)
+	}
+	return nil
+}
+
+// pipelineLog returns the log entry of the current pipeline, if any.
+func pipelineLog() *logrus.Entry {
+	entry := logrus.NewEntry(logger)
+	if len(plugin.Pipeline) > 0 {
+		entry = entry.WithField("pipeline", plugin.Pipeline)
+	}
+	return entry
+}
+
+// eventLog returns the log entry of a Kubernetes event, to trace what becomes
+// of it at the debug level.
+func eventLog(k8sEvent k8scorev1.Event) *logrus.Entry {
+	return pipelineLog().WithFields(logrus.Fields{
+		"event":  fmt.Sprintf("%s/%s", k8sEvent.Namespace, k8sEvent.Name),
+		"kind":   k8sEvent.InvolvedObject.Kind,
+		"object": k8sEvent.InvolvedObject.Name,
+		"reason": k8sEvent.Reason,
+		"type":   k8sEvent.Type,
+		"count":  k8sEvent.Count,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	assert := assert.New(t)
+	defer func() {
+		plugin.LogLevel = ""
+		plugin.LogFormat = ""
+		assert.NoError(configureLogging())
+	}()
+
+	plugin.LogLevel = "debug"
+	plugin.LogFormat = "json"
+	assert.NoError(configureLogging())
+	assert.Equal(logrus.DebugLevel, logger.Level)
+	assert.IsType(&logrus.JSONFormatter{}, logger.Formatter)
+
+	plugin.LogLevel = "verbose"
+	assert.Error(configureLogging())
+	plugin.LogLevel = "info"
+	plugin.LogFormat = "xml"
+	assert.Error(configureLogging())
+}
+
+func TestEventTrace(t *testing.T) {
+	assert := assert.New(t)
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer test.Close()
+	base := plugin
+	defer func() {
+		plugin = base
+		logger.SetOutput(os.Stderr)
+		assert.NoError(configureLogging())
+	}()
+	plugin.AgentAPIURL = test.URL
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.LogLevel = "debug"
+	plugin.LogFormat = "json"
+	require.NoError(t, configureLogging())
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+
+	processor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	k8sev := k8scorev1.Event{}
+	k8sev.Name = "nginx.1"
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.Message = "Back-off restarting failed container"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx"
+	k8sev.InvolvedObject.FieldPath = "spec.containers{nginx}"
+	_, err = processor.handle(k8sev)
+	require.NoError(t, err)
+
+	entries := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		// Other tests may still be logging
+		if entry["level"] == "debug" {
+			entries = append(entries, entry)
+		}
+	}
+	require.Len(t, entries, 3)
+	assert.Equal("Sensu event created", entries[0]["msg"])
+	assert.Equal("container-reason", entries[0]["naming"])
+	assert.Equal("default/nginx.1", entries[0]["event"])
+	assert.Equal("container-nginx-backoff", entries[0]["check"])
+	assert.Equal("Event mapped", entries[1]["msg"])
+	assert.Equal("nginx", entries[1]["entity"])
+	assert.Equal(float64(1), entries[1]["status"])
+	assert.Equal("Event delivered", entries[2]["msg"])
+
+	// Events older than the interval, the most common reason an event is
+	// missing, are logged at the debug level too
+	logs.Reset()
+	plugin.Interval = 60
+	k8sev.FirstTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	_, err = runPipeline(fake.NewSimpleClientset(), []k8scorev1.Event{k8sev})
+	require.NoError(t, err)
+	assert.Contains(logs.String(), `"filter":"interval"`)
+}
@@ -2,19 +2,20 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sensu-community/sensu-plugin-sdk/sensu"
 	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/sirupsen/logrus"
 	k8scorev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
@@ -24,20 +25,87 @@ import (
 // Config represents the check plugin config.
 type Config struct {
 	sensu.PluginConfig
-	External       bool
-	Namespace      string
-	Kubeconfig     string
-	ObjectKind     string
-	EventType      string
-	Interval       uint32
-	Handlers       []string
-	LabelSelectors string
-	StatusMap      string
-	AgentAPIURL    string
+	External                 bool
+	Namespace                string
+	Kubeconfig               string
+	ObjectKind               string
+	EventType                string
+	Interval                 uint32
+	Handlers                 []string
+	LabelSelectors           string
+	StatusMap                string
+	AgentAPIURL              string
+	EnrichPods               bool
+	CopyLabels               []string
+	CopyAnnotations          []string
+	CopyPrefix               string
+	IncludeEvent             bool
+	Cluster                  string
+	OutputTemplate           string
+	SummaryTemplate          string
+	SensuNamespace           string
+	EntityName               string
+	SensuAPIURL              string
+	SensuAPIKey              string
+	SensuTrustedCAFile       string
+	UpsertEntities           bool
+	EntitySubscriptions      []string
+	GCEntities               bool
+	GCGracePeriod            string
+	GCAction                 string
+	SensuNamespaceMap        string
+	SensuNamespaceLabel      string
+	SensuNamespaceTemplate   string
+	Sink                     string
+	HandlerRoutes            string
+	SilenceAnnotation        string
+	SilenceAction            string
+	DrainAction              string
+	DrainTaints              []string
+	MaxEventsPerEntity       int
+	MaxEventsPerCheck        int
+	MaxEventsPerRun          int
+	Aggregate                string
+	Rollup                   bool
+	RollupThresholds         string
+	RollupTop                int
+	MetricsFormat            string
+	Daemon                   bool
+	MetricsAddr              string
+	LeaderElect              bool
+	LeaderElectLease         string
+	LeaderElectNamespace     string
+	LeaderElectIdentity      string
+	LeaderElectLeaseDuration string
+	Shard                    bool
+	ShardLeasePrefix         string
+	Dedup                    string
+	DedupTTL                 string
+	DedupFile                string
+	DedupConfigMap           string
+	DedupNamespace           string
+	DedupMaxEntries          int
+	ConfigFile               string
+	LogLevel                 string
+	LogFormat                string
+	ShutdownGracePeriod      string
+	SpoolDir                 string
+	SpoolMaxEvents           int
+	CollectorURL             string
+	BatchSize                int
+	BatchWait                string
+	ScanPods                 bool
+	ScanPodsRestarts         int
+
+	// Pipeline is the name of the --config pipeline the settings are from
+	Pipeline string
 }
 
 type eventStatusMap map[string]uint32
 
+// gcGracePeriod is the parsed --gc-grace-period
+var gcGracePeriod time.Duration
+
 var (
 	plugin = Config{
 		PluginConfig: sensu.PluginConfig{
@@ -120,15 +188,578 @@ var (
 			Usage:     "The URL for the Agent API used to send events",
 			Value:     &plugin.AgentAPIURL,
 		},
+		{
+			Path:     "enrich-pods",
+			Env:      "KUBERNETES_ENRICH_PODS",
+			Argument: "enrich-pods",
+			Default:  false,
+			Usage:    "Add node, container and QoS details from the involved Pod to events",
+			Value:    &plugin.EnrichPods,
+		},
+		{
+			Path:     "copy-labels",
+			Env:      "KUBERNETES_COPY_LABELS",
+			Argument: "copy-labels",
+			Default:  []string{},
+			Usage:    "Labels of the involved object to copy to events (supports globs, e.g. app.kubernetes.io/*)",
+			Value:    &plugin.CopyLabels,
+		},
+		{
+			Path:     "copy-annotations",
+			Env:      "KUBERNETES_COPY_ANNOTATIONS",
+			Argument: "copy-annotations",
+			Default:  []string{},
+			Usage:    "Annotations of the involved object to copy to event labels (supports globs)",
+			Value:    &plugin.CopyAnnotations,
+		},
+		{
+			Path:     "copy-prefix",
+			Env:      "KUBERNETES_COPY_PREFIX",
+			Argument: "copy-prefix",
+			Default:  "",
+			Usage:    "Prefix for the keys of copied labels and annotations",
+			Value:    &plugin.CopyPrefix,
+		},
+		{
+			Path:     "include-event",
+			Env:      "KUBERNETES_INCLUDE_EVENT",
+			Argument: "include-event",
+			Default:  false,
+			Usage:    "Attach the complete Kubernetes event as JSON in the io.kubernetes.event annotation",
+			Value:    &plugin.IncludeEvent,
+		},
+		{
+			Path:     "cluster",
+			Env:      "KUBERNETES_CLUSTER",
+			Argument: "cluster",
+			Default:  "",
+			Usage:    "Name of the Kubernetes cluster, available to templates as {{.Cluster}}",
+			Value:    &plugin.Cluster,
+		},
+		{
+			Path:     "output-template",
+			Env:      "KUBERNETES_OUTPUT_TEMPLATE",
+			Argument: "output-template",
+			Default:  "",
+			Usage:    "Go template for the output of created events",
+			Value:    &plugin.OutputTemplate,
+		},
+		{
+			Path:     "summary-template",
+			Env:      "KUBERNETES_SUMMARY_TEMPLATE",
+			Argument: "summary-template",
+			Default:  "",
+			Usage:    "Go template for each event listed in the check output",
+			Value:    &plugin.SummaryTemplate,
+		},
+		{
+			Path:     "sensu-api-url",
+			Env:      "SENSU_API_URL",
+			Argument: "sensu-api-url",
+			Default:  "",
+			Usage:    "The URL of the Sensu backend API (e.g. http://sensu-backend:8080)",
+			Value:    &plugin.SensuAPIURL,
+		},
+		{
+			Path:     "sensu-api-key",
+			Env:      "SENSU_API_KEY",
+			Argument: "sensu-api-key",
+			Default:  "",
+			Secret:   true,
+			Usage:    "The API key used to authenticate with the Sensu backend API",
+			Value:    &plugin.SensuAPIKey,
+		},
+		{
+			Path:     "sensu-trusted-ca-file",
+			Env:      "SENSU_TRUSTED_CA_FILE",
+			Argument: "sensu-trusted-ca-file",
+			Default:  "",
+			Usage:    "TLS CA certificate bundle in PEM format for the Sensu backend API",
+			Value:    &plugin.SensuTrustedCAFile,
+		},
+		{
+			Path:     "upsert-entities",
+			Env:      "KUBERNETES_UPSERT_ENTITIES",
+			Argument: "upsert-entities",
+			Default:  false,
+			Usage:    "Create or update proxy entities through the Sensu backend API before sending events",
+			Value:    &plugin.UpsertEntities,
+		},
+		{
+			Path:     "entity-subscriptions",
+			Env:      "KUBERNETES_ENTITY_SUBSCRIPTIONS",
+			Argument: "entity-subscriptions",
+			Default:  []string{},
+			Usage:    "Subscriptions of upserted proxy entities",
+			Value:    &plugin.EntitySubscriptions,
+		},
+		{
+			Path:     "gc-entities",
+			Env:      "KUBERNETES_GC_ENTITIES",
+			Argument: "gc-entities",
+			Default:  false,
+			Usage:    "Deregister proxy entities created by --upsert-entities whose Kubernetes object no longer exists",
+			Value:    &plugin.GCEntities,
+		},
+		{
+			Path:     "gc-grace-period",
+			Env:      "KUBERNETES_GC_GRACE_PERIOD",
+			Argument: "gc-grace-period",
+			Default:  "1h",
+			Usage:    "How long a Kubernetes object must be missing before its proxy entity is deregistered",
+			Value:    &plugin.GCGracePeriod,
+		},
+		{
+			Path:     "gc-action",
+			Env:      "KUBERNETES_GC_ACTION",
+			Argument: "gc-action",
+			Default:  "delete",
+			Usage:    "What to do with stale proxy entities, delete them or mark them with the io.kubernetes.deleted label (delete, mark)",
+			Value:    &plugin.GCAction,
+		},
+		{
+			Path:     "sensu-namespace-map",
+			Env:      "KUBERNETES_SENSU_NAMESPACE_MAP",
+			Argument: "sensu-namespace-map",
+			Default:  "",
+			Usage:    `Map Kubernetes namespaces to Sensu namespaces (e.g. {"payments": "team-payments"})`,
+			Value:    &plugin.SensuNamespaceMap,
+		},
+		{
+			Path:     "sensu-namespace-label",
+			Env:      "KUBERNETES_SENSU_NAMESPACE_LABEL",
+			Argument: "sensu-namespace-label",
+			Default:  "",
+			Usage:    "Label of Kubernetes namespaces holding the Sensu namespace for their events",
+			Value:    &plugin.SensuNamespaceLabel,
+		},
+		{
+			Path:     "sensu-namespace-template",
+			Env:      "KUBERNETES_SENSU_NAMESPACE_TEMPLATE",
+			Argument: "sensu-namespace-template",
+			Default:  "",
+			Usage:    "Go template for the Sensu namespace of events (e.g. team-{{.Event.InvolvedObject.Namespace}})",
+			Value:    &plugin.SensuNamespaceTemplate,
+		},
+		{
+			Path:     "sink",
+			Env:      "KUBERNETES_SINK",
+			Argument: "sink",
+			Default:  "agent",
+			Usage:    "Where to send events, the agent API, the backend API or a collector accepting batches (agent, backend, collector)",
+			Value:    &plugin.Sink,
+		},
+		{
+			Path:     "handler-routes",
+			Env:      "KUBERNETES_HANDLER_ROUTES",
+			Argument: "handler-routes",
+			Default:  "",
+			Usage:    "JSON list of rules selecting event handlers by namespace, kind, reason, labels and status",
+			Value:    &plugin.HandlerRoutes,
+		},
+		{
+			Path:     "silence-annotation",
+			Env:      "KUBERNETES_SILENCE_ANNOTATION",
+			Argument: "silence-annotation",
+			Default:  "sensu.io/silence-until",
+			Usage:    "Annotation of Kubernetes objects and namespaces holding an RFC3339 time until which their events are silenced",
+			Value:    &plugin.SilenceAnnotation,
+		},
+		{
+			Path:     "silence-action",
+			Env:      "KUBERNETES_SILENCE_ACTION",
+			Argument: "silence-action",
+			Default:  "none",
+			Usage:    "What to do with events of silenced objects (none, skip, downgrade, silence)",
+			Value:    &plugin.SilenceAction,
+		},
+		{
+			Path:     "drain-action",
+			Env:      "KUBERNETES_DRAIN_ACTION",
+			Argument: "drain-action",
+			Default:  "none",
+			Usage:    "What to do with events caused by draining nodes (none, skip, downgrade)",
+			Value:    &plugin.DrainAction,
+		},
+		{
+			Path:     "drain-taints",
+			Env:      "KUBERNETES_DRAIN_TAINTS",
+			Argument: "drain-taints",
+			Default:  []string{"node.kubernetes.io/unschedulable", "ToBeDeletedByClusterAutoscaler"},
+			Usage:    "Node taints indicating a drain, in addition to cordoned nodes",
+			Value:    &plugin.DrainTaints,
+		},
+		{
+			Path:     "max-events-per-entity",
+			Env:      "KUBERNETES_MAX_EVENTS_PER_ENTITY",
+			Argument: "max-events-per-entity",
+			Default:  0,
+			Usage:    "Maximum number of events sent per entity per run, 0 for no limit",
+			Value:    &plugin.MaxEventsPerEntity,
+		},
+		{
+			Path:     "max-events-per-check",
+			Env:      "KUBERNETES_MAX_EVENTS_PER_CHECK",
+			Argument: "max-events-per-check",
+			Default:  0,
+			Usage:    "Maximum number of events sent per check name per run, 0 for no limit",
+			Value:    &plugin.MaxEventsPerCheck,
+		},
+		{
+			Path:     "max-events-per-run",
+			Env:      "KUBERNETES_MAX_EVENTS_PER_RUN",
+			Argument: "max-events-per-run",
+			Default:  0,
+			Usage:    "Maximum number of events sent per run, 0 for no limit",
+			Value:    &plugin.MaxEventsPerRun,
+		},
+		{
+			Path:     "aggregate",
+			Env:      "KUBERNETES_AGGREGATE",
+			Argument: "aggregate",
+			Default:  "none",
+			Usage:    "Send one summary event per owning workload or namespace instead of one per object (none, workload, namespace)",
+			Value:    &plugin.Aggregate,
+		},
+		{
+			Path:     "rollup",
+			Env:      "KUBERNETES_ROLLUP",
+			Argument: "rollup",
+			Default:  false,
+			Usage:    "Set the status of this check from the events sent, warning if any is alerting and critical from --rollup-thresholds",
+			Value:    &plugin.Rollup,
+		},
+		{
+			Path:     "rollup-thresholds",
+			Env:      "KUBERNETES_ROLLUP_THRESHOLDS",
+			Argument: "rollup-thresholds",
+			Default:  "",
+			Usage:    "JSON list of thresholds, by kind and reason, of alerting events making this check critical with --rollup",
+			Value:    &plugin.RollupThresholds,
+		},
+		{
+			Path:     "rollup-top",
+			Env:      "KUBERNETES_ROLLUP_TOP",
+			Argument: "rollup-top",
+			Default:  5,
+			Usage:    "Number of top offending namespaces and reasons listed in the output with --rollup",
+			Value:    &plugin.RollupTop,
+		},
+		{
+			Path:     "metrics-format",
+			Env:      "KUBERNETES_METRICS_FORMAT",
+			Argument: "metrics-format",
+			Default:  "none",
+			Usage:    "Output event counts by namespace, kind, reason and type as metrics instead of text (none, graphite_plaintext, influxdb_line, opentsdb_line, prometheus_text)",
+			Value:    &plugin.MetricsFormat,
+		},
+		{
+			Path:     "daemon",
+			Env:      "KUBERNETES_DAEMON",
+			Argument: "daemon",
+			Default:  false,
+			Usage:    "Run continuously, watching Kubernetes events, instead of as a check reading its event from STDIN",
+			Value:    &plugin.Daemon,
+		},
+		{
+			Path:     "interval",
+			Env:      "KUBERNETES_INTERVAL",
+			Argument: "interval",
+			Default:  uint32(60),
+			Usage:    "Seconds between runs (for limits, aggregation and garbage collection) in daemon mode, taken from the check otherwise",
+			Value:    &plugin.Interval,
+		},
+		{
+			Path:     "handlers",
+			Env:      "KUBERNETES_HANDLERS",
+			Argument: "handlers",
+			Default:  []string{},
+			Usage:    "Handlers of the events in daemon mode, taken from the check otherwise",
+			Value:    &plugin.Handlers,
+		},
+		{
+			Path:     "sensu-namespace",
+			Env:      "KUBERNETES_SENSU_NAMESPACE",
+			Argument: "sensu-namespace",
+			Default:  "default",
+			Usage:    "Sensu namespace of the events in daemon mode, taken from the check otherwise",
+			Value:    &plugin.SensuNamespace,
+		},
+		{
+			Path:     "entity-name",
+			Env:      "KUBERNETES_ENTITY_NAME",
+			Argument: "entity-name",
+			Default:  "",
+			Usage:    "Entity of the events about the cluster as a whole in daemon mode, taken from the check otherwise",
+			Value:    &plugin.EntityName,
+		},
+		{
+			Path:     "metrics-addr",
+			Env:      "KUBERNETES_METRICS_ADDR",
+			Argument: "metrics-addr",
+			Default:  "",
+			Usage:    "Address (e.g. :8080) serving Prometheus metrics on /metrics and probes on /healthz and /readyz in daemon mode",
+			Value:    &plugin.MetricsAddr,
+		},
+		{
+			Path:     "leader-elect",
+			Env:      "KUBERNETES_LEADER_ELECT",
+			Argument: "leader-elect",
+			Default:  false,
+			Usage:    "Only process events while holding a Lease in daemon mode, for replicas to fail over",
+			Value:    &plugin.LeaderElect,
+		},
+		{
+			Path:     "leader-elect-lease",
+			Env:      "KUBERNETES_LEADER_ELECT_LEASE",
+			Argument: "leader-elect-lease",
+			Default:  "sensu-kubernetes-events",
+			Usage:    "Name of the leader election Lease",
+			Value:    &plugin.LeaderElectLease,
+		},
+		{
+			Path:     "leader-elect-namespace",
+			Env:      "KUBERNETES_LEADER_ELECT_NAMESPACE",
+			Argument: "leader-elect-namespace",
+			Default:  "",
+			Usage:    "Namespace of the leader election Lease (defaults to the namespace of the pod)",
+			Value:    &plugin.LeaderElectNamespace,
+		},
+		{
+			Path:     "leader-elect-identity",
+			Env:      "KUBERNETES_LEADER_ELECT_IDENTITY",
+			Argument: "leader-elect-identity",
+			Default:  "",
+			Usage:    "Identity of this replica in the leader election (defaults to the hostname)",
+			Value:    &plugin.LeaderElectIdentity,
+		},
+		{
+			Path:     "leader-elect-lease-duration",
+			Env:      "KUBERNETES_LEADER_ELECT_LEASE_DURATION",
+			Argument: "leader-elect-lease-duration",
+			Default:  "15s",
+			Usage:    "How long replicas wait before taking over the Lease of a leader that stopped renewing it",
+			Value:    &plugin.LeaderElectLeaseDuration,
+		},
+		{
+			Path:     "shard",
+			Env:      "KUBERNETES_SHARD",
+			Argument: "shard",
+			Default:  false,
+			Usage:    "Shard namespaces across the replicas of the daemon mode, which register with Leases",
+			Value:    &plugin.Shard,
+		},
+		{
+			Path:     "shard-lease-prefix",
+			Env:      "KUBERNETES_SHARD_LEASE_PREFIX",
+			Argument: "shard-lease-prefix",
+			Default:  "sensu-kubernetes-events-shard",
+			Usage:    "Prefix of the names of the Leases of the replicas sharing namespaces",
+			Value:    &plugin.ShardLeasePrefix,
+		},
+		{
+			Path:     "dedup",
+			Env:      "KUBERNETES_DEDUP",
+			Argument: "dedup",
+			Default:  "none",
+			Usage:    "Where to record forwarded events to not forward them again (none, memory, file, configmap)",
+			Value:    &plugin.Dedup,
+		},
+		{
+			Path:     "dedup-ttl",
+			Env:      "KUBERNETES_DEDUP_TTL",
+			Argument: "dedup-ttl",
+			Default:  "1h",
+			Usage:    "How long forwarded events are recorded",
+			Value:    &plugin.DedupTTL,
+		},
+		{
+			Path:     "dedup-file",
+			Env:      "KUBERNETES_DEDUP_FILE",
+			Argument: "dedup-file",
+			Default:  filepath.Join(os.TempDir(), "sensu-kubernetes-events-dedup.json"),
+			Usage:    "File recording forwarded events with --dedup file",
+			Value:    &plugin.DedupFile,
+		},
+		{
+			Path:     "dedup-configmap",
+			Env:      "KUBERNETES_DEDUP_CONFIGMAP",
+			Argument: "dedup-configmap",
+			Default:  "sensu-kubernetes-events-dedup",
+			Usage:    "ConfigMap recording forwarded events with --dedup configmap",
+			Value:    &plugin.DedupConfigMap,
+		},
+		{
+			Path:     "dedup-namespace",
+			Env:      "KUBERNETES_DEDUP_NAMESPACE",
+			Argument: "dedup-namespace",
+			Default:  "",
+			Usage:    "Namespace of the --dedup-configmap (defaults to the namespace of the pod, or default)",
+			Value:    &plugin.DedupNamespace,
+		},
+		{
+			Path:     "dedup-max-entries",
+			Env:      "KUBERNETES_DEDUP_MAX_ENTRIES",
+			Argument: "dedup-max-entries",
+			Default:  5000,
+			Usage:    "Maximum number of forwarded events recorded, the oldest records being dropped beyond it",
+			Value:    &plugin.DedupMaxEntries,
+		},
+		{
+			Path:     "config",
+			Env:      "KUBERNETES_EVENTS_CONFIG",
+			Argument: "config",
+			Default:  "",
+			Usage:    "YAML file of pipelines, each overriding flags, processing the events of a single List or Watch",
+			Value:    &plugin.ConfigFile,
+		},
+		{
+			Path:     "log-level",
+			Env:      "KUBERNETES_LOG_LEVEL",
+			Argument: "log-level",
+			Default:  "info",
+			Usage:    "Level of the logs written to STDERR, debug tracing what becomes of each Kubernetes event (trace, debug, info, warning, error)",
+			Value:    &plugin.LogLevel,
+		},
+		{
+			Path:     "log-format",
+			Env:      "KUBERNETES_LOG_FORMAT",
+			Argument: "log-format",
+			Default:  "text",
+			Usage:    "Format of the logs (text, json)",
+			Value:    &plugin.LogFormat,
+		},
+		{
+			Path:     "shutdown-grace-period",
+			Env:      "KUBERNETES_SHUTDOWN_GRACE_PERIOD",
+			Argument: "shutdown-grace-period",
+			Default:  "30s",
+			Usage:    "How long to deliver the events already taken in after SIGTERM or SIGINT, before API requests are canceled",
+			Value:    &plugin.ShutdownGracePeriod,
+		},
+		{
+			Path:     "spool-dir",
+			Env:      "KUBERNETES_SPOOL_DIR",
+			Argument: "spool-dir",
+			Default:  "",
+			Usage:    "Directory spooling the events that fail to be delivered, replayed on the next run",
+			Value:    &plugin.SpoolDir,
+		},
+		{
+			Path:     "spool-max-events",
+			Env:      "KUBERNETES_SPOOL_MAX_EVENTS",
+			Argument: "spool-max-events",
+			Default:  1000,
+			Usage:    "Maximum number of events in the --spool-dir, the oldest being dropped",
+			Value:    &plugin.SpoolMaxEvents,
+		},
+		{
+			Path:     "collector-url",
+			Env:      "KUBERNETES_COLLECTOR_URL",
+			Argument: "collector-url",
+			Default:  "",
+			Usage:    "The URL events are posted to as JSON arrays with --sink collector",
+			Value:    &plugin.CollectorURL,
+		},
+		{
+			Path:     "batch-size",
+			Env:      "KUBERNETES_BATCH_SIZE",
+			Argument: "batch-size",
+			Default:  1,
+			Usage:    "Maximum number of events per request to sinks accepting batches, 1 for no batching",
+			Value:    &plugin.BatchSize,
+		},
+		{
+			Path:     "batch-wait",
+			Env:      "KUBERNETES_BATCH_WAIT",
+			Argument: "batch-wait",
+			Default:  "1s",
+			Usage:    "How long an event may wait for its batch to fill up",
+			Value:    &plugin.BatchWait,
+		},
+		{
+			Path:     "scan-pods",
+			Env:      "KUBERNETES_SCAN_PODS",
+			Argument: "scan-pods",
+			Default:  false,
+			Usage:    "Also send events for the containers of Pods stuck waiting, OOMKilled or restarting, found in their status",
+			Value:    &plugin.ScanPods,
+		},
+		{
+			Path:     "scan-pods-restarts",
+			Env:      "KUBERNETES_SCAN_PODS_RESTARTS",
+			Argument: "scan-pods-restarts",
+			Default:  5,
+			Usage:    "Restart count from which --scan-pods sends an event for a container, 0 to not check restarts",
+			Value:    &plugin.ScanPodsRestarts,
+		},
 	}
 )
 
 func main() {
-	check := sensu.NewGoCheck(&plugin.PluginConfig, options, checkArgs, executeCheck, true)
+	check := sensu.NewGoCheck(&plugin.PluginConfig, options, checkArgs, executeCheck, !daemonMode(os.Args[1:]))
 	check.Execute()
 }
 
 func checkArgs(event *corev2.Event) (int, error) {
+	// Pick these up from the STDIN event, there is none in daemon mode
+	if event != nil {
+		plugin.Interval = event.Check.Interval
+		plugin.Handlers = event.Check.Handlers
+		plugin.SensuNamespace = event.Check.Namespace
+		if event.Entity != nil {
+			plugin.EntityName = event.Entity.Name
+		}
+	}
+
+	if err := configureLogging(); err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	if len(plugin.SpoolDir) > 0 && plugin.SpoolMaxEvents <= 0 {
+		return sensu.CheckStateCritical, fmt.Errorf("--spool-max-events must be positive with --spool-dir")
+	}
+	if plugin.BatchSize > 1 {
+		var err error
+		batchWait, err = time.ParseDuration(plugin.BatchWait)
+		if err != nil {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --batch-wait %q: %v", plugin.BatchWait, err)
+		}
+		if batchWait <= 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --batch-wait %q, must be positive", plugin.BatchWait)
+		}
+	}
+	if len(plugin.ShutdownGracePeriod) > 0 {
+		var err error
+		shutdownGracePeriod, err = time.ParseDuration(plugin.ShutdownGracePeriod)
+		if err != nil {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --shutdown-grace-period %q: %v", plugin.ShutdownGracePeriod, err)
+		}
+	}
+
+	if len(plugin.ConfigFile) == 0 {
+		status, err := validateConfig()
+		if err != nil {
+			return status, err
+		}
+		pipelines = []*pipeline{capturePipeline()}
+		return sensu.CheckStateOK, nil
+	}
+
+	if plugin.MetricsFormat != "none" && len(plugin.MetricsFormat) > 0 {
+		return sensu.CheckStateCritical, fmt.Errorf("--metrics-format is not supported with --config")
+	}
+	flagConfig = plugin
+	var err error
+	pipelines, err = loadPipelines(plugin.ConfigFile)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	return sensu.CheckStateOK, nil
+}
+
+// validateConfig validates the current settings, normalizing them and parsing
+// the settings that need to be.
+func validateConfig() (int, error) {
 	if plugin.External {
 		if len(plugin.Kubeconfig) == 0 {
 			if home := homeDir(); home != "" {
@@ -142,24 +773,148 @@ func checkArgs(event *corev2.Event) (int, error) {
 		plugin.EventType = fmt.Sprintf("=%s", plugin.EventType)
 	}
 
-	// Pick these up from the STDIN event
-	plugin.Interval = event.Check.Interval
-	plugin.Handlers = event.Check.Handlers
-
 	if len(plugin.Namespace) == 0 {
-		plugin.Namespace = event.Check.Namespace
+		plugin.Namespace = plugin.SensuNamespace
 	} else if plugin.Namespace == "all" {
 		plugin.Namespace = ""
 	}
 
+	if plugin.Daemon && plugin.Interval == 0 {
+		return sensu.CheckStateCritical, fmt.Errorf("--interval must be positive with --daemon")
+	}
+
 	if len(plugin.AgentAPIURL) == 0 {
 		return sensu.CheckStateCritical, fmt.Errorf("--agent-api-url or env var KUBERNETES_AGENT_API_URL required")
 	}
 
+	if plugin.UpsertEntities && len(plugin.SensuAPIURL) == 0 {
+		return sensu.CheckStateCritical, fmt.Errorf("--sensu-api-url or env var SENSU_API_URL required with --upsert-entities")
+	}
+
+	if plugin.GCEntities {
+		if len(plugin.SensuAPIURL) == 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("--sensu-api-url or env var SENSU_API_URL required with --gc-entities")
+		}
+		if plugin.GCAction != "delete" && plugin.GCAction != "mark" {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --gc-action %q, must be delete or mark", plugin.GCAction)
+		}
+		var err error
+		gcGracePeriod, err = time.ParseDuration(plugin.GCGracePeriod)
+		if err != nil {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --gc-grace-period %q: %v", plugin.GCGracePeriod, err)
+		}
+	}
+
+	if plugin.LeaderElect && plugin.Shard {
+		return sensu.CheckStateCritical, fmt.Errorf("--leader-elect and --shard are mutually exclusive")
+	}
+	if plugin.LeaderElect || plugin.Shard {
+		if !plugin.Daemon {
+			return sensu.CheckStateCritical, fmt.Errorf("--leader-elect and --shard require --daemon")
+		}
+		var err error
+		leaderElectLeaseDuration, err = time.ParseDuration(plugin.LeaderElectLeaseDuration)
+		if err != nil {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --leader-elect-lease-duration %q: %v", plugin.LeaderElectLeaseDuration, err)
+		}
+		if leaderElectLeaseDuration < time.Second {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --leader-elect-lease-duration %q, must be at least 1s", plugin.LeaderElectLeaseDuration)
+		}
+	}
+
+	switch plugin.Dedup {
+	case "", "none", "memory", "file", "configmap":
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --dedup %q, must be none, memory, file or configmap", plugin.Dedup)
+	}
+	if plugin.Dedup != "none" && len(plugin.Dedup) > 0 {
+		var err error
+		dedupTTL, err = time.ParseDuration(plugin.DedupTTL)
+		if err != nil {
+			return sensu.CheckStateCritical, fmt.Errorf("invalid --dedup-ttl %q: %v", plugin.DedupTTL, err)
+		}
+		if plugin.DedupMaxEntries <= 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("--dedup-max-entries must be positive with --dedup")
+		}
+	}
+
+	switch plugin.Sink {
+	case "", "agent":
+	case "backend":
+		if len(plugin.SensuAPIURL) == 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("--sensu-api-url or env var SENSU_API_URL required with --sink backend")
+		}
+	case "collector":
+		if len(plugin.CollectorURL) == 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("--collector-url or env var KUBERNETES_COLLECTOR_URL required with --sink collector")
+		}
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --sink %q, must be agent, backend or collector", plugin.Sink)
+	}
+
+	switch plugin.SilenceAction {
+	case "", "none", "skip", "downgrade":
+	case "silence":
+		if len(plugin.SensuAPIURL) == 0 {
+			return sensu.CheckStateCritical, fmt.Errorf("--sensu-api-url or env var SENSU_API_URL required with --silence-action silence")
+		}
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --silence-action %q, must be none, skip, downgrade or silence", plugin.SilenceAction)
+	}
+
+	switch plugin.DrainAction {
+	case "", "none", "skip", "downgrade":
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --drain-action %q, must be none, skip or downgrade", plugin.DrainAction)
+	}
+
+	if plugin.ScanPodsRestarts < 0 {
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --scan-pods-restarts %d, must not be negative", plugin.ScanPodsRestarts)
+	}
+
+	switch plugin.Aggregate {
+	case "", "none", "workload", "namespace":
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --aggregate %q, must be none, workload or namespace", plugin.Aggregate)
+	}
+
+	switch plugin.MetricsFormat {
+	case "", "none", "graphite_plaintext", "influxdb_line", "opentsdb_line", "prometheus_text":
+	default:
+		return sensu.CheckStateCritical, fmt.Errorf("invalid --metrics-format %q, must be none, graphite_plaintext, influxdb_line, opentsdb_line or prometheus_text", plugin.MetricsFormat)
+	}
+
+	var err error
+	namespaceMap, err = parseNamespaceMap(plugin.SensuNamespaceMap)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	namespaceTemplate, err = parseTemplate("sensu-namespace-template", plugin.SensuNamespaceTemplate)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	handlerRoutes, err = parseHandlerRoutes(plugin.HandlerRoutes)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	rollupThresholds, err = parseRollupThresholds(plugin.RollupThresholds)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	outputTemplate, err = parseTemplate("output-template", plugin.OutputTemplate)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	summaryTemplate, err = parseTemplate("summary-template", plugin.SummaryTemplate)
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+
 	return sensu.CheckStateOK, nil
 }
 
 func executeCheck(event *corev2.Event) (int, error) {
+	handleShutdown()
 
 	var config *rest.Config
 	var err error
@@ -181,55 +936,159 @@ func executeCheck(event *corev2.Event) (int, error) {
 		return sensu.CheckStateCritical, fmt.Errorf("Failed to get clientset: %v", err)
 	}
 
-	var fieldSelectors []string
-
-	if len(plugin.EventType) > 0 {
-		// The plugin.EventType should include its operator (=/!=) that's why the
-		// the string is abutted to the type string below
-		fieldSelectors = append(fieldSelectors, fmt.Sprintf("type%s", plugin.EventType))
-	}
+	namespace, listOptions := sharedListOptions(pipelines)
 
-	if len(plugin.ObjectKind) > 0 {
-		fieldSelectors = append(fieldSelectors, fmt.Sprintf("involvedObject.kind=%s", plugin.ObjectKind))
+	if plugin.Daemon {
+		if err := runDaemon(clientset, namespace, listOptions); err != nil {
+			return sensu.CheckStateCritical, err
+		}
+		return sensu.CheckStateOK, nil
 	}
 
-	listOptions := metav1.ListOptions{}
-
-	if len(fieldSelectors) > 0 {
-		listOptions.FieldSelector = strings.Join(fieldSelectors, ",")
+	events, err := clientset.CoreV1().Events(namespace).List(apiContext, listOptions)
+	if err != nil {
+		return sensu.CheckStateCritical, fmt.Errorf("Failed to get events: %v", err)
 	}
 
-	if len(plugin.LabelSelectors) > 0 {
-		listOptions.LabelSelector = plugin.LabelSelectors
+	status := sensu.CheckStateOK
+	for _, p := range pipelines {
+		p.activate()
+		pipelineStatus, err := runPipeline(clientset, events.Items)
+		if err != nil {
+			return sensu.CheckStateCritical, err
+		}
+		if pipelineStatus > status {
+			status = pipelineStatus
+		}
 	}
+	return status, nil
+}
 
-	events, err := clientset.CoreV1().Events(plugin.Namespace).List(context.TODO(), listOptions)
+// runPipeline processes the events listed by a check run under the current
+// settings, and prints its output.
+func runPipeline(clientset kubernetes.Interface, items []k8scorev1.Event) (int, error) {
+	output := []string{}
+	processor, err := newEventProcessor(clientset)
 	if err != nil {
-		return sensu.CheckStateCritical, fmt.Errorf("Failed to get events: %v", err)
+		return sensu.CheckStateCritical, err
 	}
 
-	output := []string{}
-
-	for _, item := range events.Items {
+	interrupted := 0
+	for i, item := range items {
+		if shuttingDown() {
+			// Send what was processed so far
+			interrupted = len(items) - i
+			pipelineLog().Warnf("Stopped processing events on shutdown, %d event(s) left", interrupted)
+			break
+		}
 		if time.Since(item.FirstTimestamp.Time).Seconds() <= float64(plugin.Interval) {
-			output = append(output, fmt.Sprintf("Event for %s %s in namespace %s, reason: %q, message: %q", item.InvolvedObject.Kind, item.ObjectMeta.Name, item.ObjectMeta.Namespace, item.Reason, item.Message))
-			event, err := createSensuEvent(item)
+			selected, err := eventSelected(item)
 			if err != nil {
 				return sensu.CheckStateCritical, err
 			}
-			err = submitEventAgentAPI(event)
+			if !selected {
+				eventLog(item).WithField("filter", "pipeline").Debug("Event filtered: not selected by the pipeline")
+				continue
+			}
+			summary, err := processor.handle(item)
 			if err != nil {
 				return sensu.CheckStateCritical, err
 			}
+			if len(summary) > 0 {
+				output = append(output, summary)
+			}
+		} else {
+			eventLog(item).WithField("filter", "interval").Debug("Event filtered: first seen before the check interval")
+		}
+	}
+
+	var scanErr error
+	if plugin.ScanPods && interrupted == 0 {
+		scanned, err := processor.scanPods(time.Now())
+		if err != nil {
+			// Like in daemon mode, the events of the run are still flushed
+			pipelineLog().Error(err)
+			scanErr = err
+		}
+		for _, item := range scanned {
+			summary, err := processor.handle(item)
+			if err != nil {
+				return sensu.CheckStateCritical, err
+			}
+			if len(summary) > 0 {
+				output = append(output, summary)
+			}
+		}
+	}
+
+	flushed, err := processor.flush()
+	if err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	output = append(output, flushed...)
+
+	status := sensu.CheckStateOK
+	var rollup []string
+	if processor.rollup != nil {
+		status, rollup = processor.rollup.result()
+	}
+
+	var collected []string
+	if plugin.GCEntities {
+		collected, err = processor.collectEntities()
+		if err != nil {
+			return sensu.CheckStateCritical, err
+		}
+	}
+
+	if processor.metrics != nil {
+		// The output is parsed as metrics, so it can't include the summary
+		for _, line := range processor.metrics.metrics(plugin.MetricsFormat, time.Now()) {
+			fmt.Println(line)
 		}
+		return status, nil
 	}
 
+	if len(plugin.Pipeline) > 0 {
+		fmt.Printf("[%s] ", plugin.Pipeline)
+	}
+	listOptions := eventListOptions()
 	fmt.Printf("There are %d event(s) in the cluster that match field %q and label %q\n", len(output), listOptions.FieldSelector, listOptions.LabelSelector)
 	for _, out := range output {
 		fmt.Println(out)
 	}
+	reasons := make([]string, 0, len(processor.skipped))
+	for reason := range processor.skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("Skipped %d %s event(s)\n", processor.skipped[reason], reason)
+	}
+	for _, out := range collected {
+		fmt.Println(out)
+	}
+	for _, out := range rollup {
+		fmt.Println(out)
+	}
+	if processor.spool != nil && processor.spool.depth() > 0 && status < sensu.CheckStateWarning {
+		// The spooled events are delivered late
+		status = sensu.CheckStateWarning
+	}
+	if scanErr != nil {
+		fmt.Printf("%v, container problems not scanned\n", scanErr)
+		if status < sensu.CheckStateWarning {
+			status = sensu.CheckStateWarning
+		}
+	}
+	if interrupted > 0 {
+		fmt.Printf("Interrupted by shutdown, %d event(s) left unprocessed\n", interrupted)
+		if status < sensu.CheckStateWarning {
+			status = sensu.CheckStateWarning
+		}
+	}
 
-	return sensu.CheckStateOK, nil
+	return status, nil
 }
 
 func homeDir() string {
@@ -239,6 +1098,28 @@ func homeDir() string {
 	return os.Getenv("USERPROFILE") // windows
 }
 
+// referencesContainer reports whether an involved object field path
+// references a container or an init container of a Pod.
+func referencesContainer(fieldPath string) bool {
+	lowerFieldPath := strings.ToLower(fieldPath)
+	return strings.HasPrefix(lowerFieldPath, "spec.containers") || strings.HasPrefix(lowerFieldPath, "spec.initcontainers")
+}
+
+// containerName returns the container name referenced by an involved object
+// field path (e.g. "spec.containers{nginx}" or "spec.initContainers{init}"),
+// or an empty string if the field path does not reference a container.
+func containerName(fieldPath string) string {
+	if !referencesContainer(fieldPath) {
+		return ""
+	}
+	start := strings.Index(fieldPath, "{") + 1
+	end := strings.Index(fieldPath, "}")
+	if start <= 0 || end < start {
+		return ""
+	}
+	return fieldPath[start:end]
+}
+
 func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 	event := &corev2.Event{}
 	event.Check = &corev2.Check{}
@@ -254,24 +1135,40 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 	event.ObjectMeta.Labels = make(map[string]string)
 	event.ObjectMeta.Labels["io.kubernetes.event.id"] = k8sEvent.ObjectMeta.Name
 	event.ObjectMeta.Labels["io.kubernetes.event.namespace"] = k8sEvent.ObjectMeta.Namespace
+	event.ObjectMeta.Labels["io.kubernetes.reason"] = k8sEvent.Reason
+	event.ObjectMeta.Labels["io.kubernetes.kind"] = k8sEvent.InvolvedObject.Kind
+	event.ObjectMeta.Labels["io.kubernetes.object.name"] = k8sEvent.InvolvedObject.Name
+	event.ObjectMeta.Labels["io.kubernetes.count"] = strconv.Itoa(int(k8sEvent.Count))
 
-	// Sensu Event Name
+	// The complete Kubernetes event, for handlers that need fields we don't
+	// otherwise carry over (source, reportingController, timestamps, etc.)
+	if plugin.IncludeEvent {
+		encoded, err := json.Marshal(k8sEvent)
+		if err != nil {
+			return &corev2.Event{}, fmt.Errorf("Failed to encode Kubernetes event %s: %v", k8sEvent.ObjectMeta.Name, err)
+		}
+		event.ObjectMeta.Annotations = make(map[string]string)
+		event.ObjectMeta.Annotations["io.kubernetes.event"] = string(encoded)
+	}
+
+	// Sensu Event Name, naming tells which rule named it for the debug logs
+	var naming string
 	switch lowerKind {
 	case "pod":
-		if strings.HasPrefix(lowerFieldPath, "spec.containers") {
+		if referencesContainer(lowerFieldPath) {
 			// This is a Pod/Container event (i.e. an event that is associated with a
-			// K8s Pod resource, with reference to a specific container in the pod).
+			// K8s Pod resource, with reference to a specific container in the pod,
+			// or init container).
 			// Pod/Container event names need to be prefixed with container names to
 			// avoid event name collisions (e.g. container-influxdb-backoff vs
 			// container-grafana-backoff).
-			start := strings.Index(lowerFieldPath, "{") + 1
-			end := strings.Index(lowerFieldPath, "}")
-			container := lowerFieldPath[start:end]
+			container := containerName(lowerFieldPath)
 			if len(msgFields) == 2 && msgFields[0] == "Error:" {
 				// Expected output: container-<container_name>-<error>
 				//
 				// Example(s):
 				// - container-nginx-imagepullbackoff
+				naming = "container-error"
 				event.Check.ObjectMeta.Name = fmt.Sprintf(
 					"container-%s-%s",
 					strings.ToLower(container),
@@ -282,6 +1179,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 				//
 				// Example(s):
 				// - container-nginx-started
+				naming = "container-reason"
 				event.Check.ObjectMeta.Name = fmt.Sprintf(
 					"container-%s-%s",
 					strings.ToLower(container),
@@ -297,6 +1195,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			// - pod-scheduled
 			// - pod-created
 			// - pod-deleted
+			naming = "pod-reason"
 			event.Check.ObjectMeta.Name = fmt.Sprintf(
 				"pod-%s",
 				lowerReason,
@@ -323,6 +1222,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			// Many replicaset events have messages like "Created pod:
 			// nginx-bbd465f66-rwb2d". We want to capture the first word
 			// in this string as the event "verb".
+			naming = "replicaset-pod-verb"
 			verb := strings.ToLower(msgFields[0])
 			event.Check.ObjectMeta.Name = fmt.Sprintf(
 				"pod-%s",
@@ -335,6 +1235,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			//
 			// Example(s):
 			// - replicaset-deleted
+			naming = "replicaset-reason"
 			event.Check.ObjectMeta.Name = strings.ToLower(
 				fmt.Sprintf(
 					"replicaset-%s",
@@ -356,6 +1257,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			//
 			// Example(s):
 			// - replicaset-nginx-12345-deleted
+			naming = "deployment-replicaset-reason"
 			message := strings.Split(lowerMessage, "replica set")
 			replicaset := strings.Fields(message[1])[0] // first word after "replica set"
 			event.Check.ObjectMeta.Name = fmt.Sprintf(
@@ -370,6 +1272,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			//
 			// Example(s):
 			// - nginx-deleted
+			naming = "deployment-reason"
 			event.Check.ObjectMeta.Name = fmt.Sprintf(
 				"%s-%s",
 				lowerName,
@@ -380,6 +1283,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 		// This is an Endpoint event.
 		//
 		// Expected output: endpoint-<endpoint_name>-<reason>
+		naming = "endpoints-reason"
 		event.Check.ObjectMeta.Name = fmt.Sprintf(
 			"endpoint-%s-%s",
 			lowerName,
@@ -389,15 +1293,17 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 		// NOTE: Node deletion event "reason" field values appear to be quite
 		// inconsistent compared to other Node events.
 		if strings.HasPrefix(lowerReason, "deleting node") {
-
+			naming = "node-deleting"
 			event.Check.ObjectMeta.Name = "deletingnode"
 		} else {
 			// Most node events have pretty clean "reason" field values
+			naming = "node-reason"
 			event.Check.ObjectMeta.Name = lowerReason
 		}
 	default:
 		if len(msgFields) == 2 && msgFields[0] == "Error:" {
 			// If we have a definitive single word error message, use that as the check name
+			naming = "error-message"
 			event.Check.ObjectMeta.Name = msgFields[1]
 		} else {
 			// This is a valid event that we don't have special handling for. If you
@@ -411,6 +1317,7 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 			//
 			// NOTE: these event names can be used to collect the underlying K8s
 			// event; e.g.: kubectl describe event nginx-bbd465f66.162cb9a548a2a604
+			naming = "event-name"
 			event.Check.ObjectMeta.Name = k8sEvent.ObjectMeta.Name
 		}
 	}
@@ -466,24 +1373,35 @@ func createSensuEvent(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
 	event.Timestamp = k8sEvent.LastTimestamp.Time.Unix()
 	event.Check.Interval = plugin.Interval
 	event.Check.Handlers = plugin.Handlers
-	event.Check.Output = fmt.Sprintf(
-		"Event for %s %s in namespace %s, reason: %q, message: %q\n",
-		k8sEvent.InvolvedObject.Kind,
-		k8sEvent.ObjectMeta.Name,
-		k8sEvent.ObjectMeta.Namespace,
-		k8sEvent.Reason,
-		k8sEvent.Message,
-	)
+	event.Check.Output, err = eventOutput(k8sEvent)
+	if err != nil {
+		return &corev2.Event{}, err
+	}
+	eventLog(k8sEvent).WithFields(logrus.Fields{
+		"naming": naming,
+		"entity": event.Check.ProxyEntityName,
+		"check":  event.Check.ObjectMeta.Name,
+		"status": event.Check.Status,
+	}).Debug("Sensu event created")
 	return event, nil
 }
 
 func submitEventAgentAPI(event *corev2.Event) error {
 
 	encoded, _ := json.Marshal(event)
-	resp, err := http.Post(plugin.AgentAPIURL, "application/json", bytes.NewBuffer(encoded))
+	req, err := http.NewRequestWithContext(apiContext, http.MethodPost, plugin.AgentAPIURL, bytes.NewBuffer(encoded))
+	if err != nil {
+		return fmt.Errorf("Failed to create request to %s: %v", plugin.AgentAPIURL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("Failed to post event to %s failed: %v", plugin.AgentAPIURL, err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return rejectedEventError{fmt.Errorf("POST of event to %s failed with status %v\nevent: %s", plugin.AgentAPIURL, resp.Status, string(encoded))}
+	}
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		return fmt.Errorf("POST of event to %s failed with status %v\nevent: %s", plugin.AgentAPIURL, resp.Status, string(encoded))
 	}
@@ -73,6 +73,16 @@ func TestCreateSensuEvent(t *testing.T) {
 			k8sInvObjName,
 			"container-myservice-imagepullbackoff",
 		},
+		{
+			"Pod",
+			"spec.initContainers{migrate}",
+			"Warning",
+			"BackOff",
+			"Back-off restarting failed container",
+			1,
+			k8sInvObjName,
+			"container-migrate-backoff",
+		},
 		{
 			"Pod",
 			"spec.containers{myservice}",
@@ -225,9 +235,44 @@ func TestCreateSensuEvent(t *testing.T) {
 		assert.Equal(tc.evStatus, ev.Check.Status)
 		assert.Equal(tc.evEntityName, ev.Check.ProxyEntityName)
 		assert.Equal(tc.evCheckName, ev.Check.ObjectMeta.Name)
+		assert.Equal(tc.k8sReason, ev.ObjectMeta.Labels["io.kubernetes.reason"])
+		assert.Equal(tc.k8sInvObjKind, ev.ObjectMeta.Labels["io.kubernetes.kind"])
+		assert.Equal(k8sInvObjName, ev.ObjectMeta.Labels["io.kubernetes.object.name"])
+		assert.Equal("1", ev.ObjectMeta.Labels["io.kubernetes.count"])
+		assert.Empty(ev.ObjectMeta.Annotations["io.kubernetes.event"])
 	}
 }
 
+func TestCreateSensuEventIncludeEvent(t *testing.T) {
+	assert := assert.New(t)
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.IncludeEvent = true
+	defer func() { plugin.IncludeEvent = false }()
+
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Name = "nginx-1.162cb9a548a2a604"
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	k8sev.InvolvedObject.UID = "6e7a7d3c-5f0b-4f57-9d0e-3f4a3b1c2d1e"
+	k8sev.Source.Component = "kubelet"
+	k8sev.Source.Host = "node-1"
+	k8sev.ReportingController = "kubelet"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.Count = 7
+
+	ev, err := createSensuEvent(k8sev)
+	assert.NoError(err)
+	assert.Equal("7", ev.ObjectMeta.Labels["io.kubernetes.count"])
+	decoded := k8scorev1.Event{}
+	require.NoError(t, json.Unmarshal([]byte(ev.ObjectMeta.Annotations["io.kubernetes.event"]), &decoded))
+	assert.Equal(k8sev.InvolvedObject, decoded.InvolvedObject)
+	assert.Equal(k8sev.Source, decoded.Source)
+	assert.Equal("kubelet", decoded.ReportingController)
+	assert.Equal(int32(7), decoded.Count)
+}
+
 func TestSubmitEventAgentAPI(t *testing.T) {
 	testcases := []struct {
 		httpStatus  int
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// matchKey reports whether a label or annotation key matches an allowlist
+// pattern. Patterns are either exact keys, prefixes ending in "*" (e.g.
+// "app.kubernetes.io/*") or path.Match style globs.
+func matchKey(pattern, key string) bool {
+	if pattern == key {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") && !strings.ContainsAny(pattern[:len(pattern)-1], "*?[") {
+		return strings.HasPrefix(key, strings.TrimSuffix(pattern, "*"))
+	}
+	matched, err := path.Match(pattern, key)
+	return err == nil && matched
+}
+
+// copyMatching copies the entries of src whose key matches any of the
+// patterns into dst, prefixing the keys with prefix.
+func copyMatching(dst, src map[string]string, patterns []string, prefix string) {
+	for key, value := range src {
+		for _, pattern := range patterns {
+			if matchKey(pattern, key) {
+				dst[prefix+key] = value
+				break
+			}
+		}
+	}
+}
+
+// copyObjectMetadata looks up the object involved in a Kubernetes event and
+// copies its labels and annotations matching the --copy-labels and
+// --copy-annotations allowlists to the Sensu event and check labels.
+func copyObjectMetadata(event *corev2.Event, k8sEvent k8scorev1.Event, cache *objectCache) error {
+	if len(plugin.CopyLabels) == 0 && len(plugin.CopyAnnotations) == 0 {
+		return nil
+	}
+
+	meta, err := cache.getObjectMeta(k8sEvent.InvolvedObject, k8sEvent.ObjectMeta.Namespace)
+	if err == errUnsupportedKind {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if meta == nil {
+		return nil
+	}
+
+	copied := make(map[string]string)
+	copyMatching(copied, meta.Labels, plugin.CopyLabels, plugin.CopyPrefix)
+	copyMatching(copied, meta.Annotations, plugin.CopyAnnotations, plugin.CopyPrefix)
+	if len(copied) == 0 {
+		return nil
+	}
+
+	if event.ObjectMeta.Labels == nil {
+		event.ObjectMeta.Labels = make(map[string]string)
+	}
+	if event.Check.ObjectMeta.Labels == nil {
+		event.Check.ObjectMeta.Labels = make(map[string]string)
+	}
+	for key, value := range copied {
+		event.ObjectMeta.Labels[key] = value
+		event.Check.ObjectMeta.Labels[key] = value
+	}
+
+	return nil
+}
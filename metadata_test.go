@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMatchKey(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"team", "team", true},
+		{"team", "teams", false},
+		{"app.kubernetes.io/*", "app.kubernetes.io/name", true},
+		{"app.kubernetes.io/*", "app.kubernetes.io/part-of", true},
+		{"app.kubernetes.io/*", "helm.sh/chart", false},
+		{"*", "app.kubernetes.io/name", true},
+		{"sensu.io/?eam", "sensu.io/team", true},
+		{"*/team", "example.com/team", true},
+		{"*/team", "team", false},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, tc.match, matchKey(tc.pattern, tc.key), "%s %s", tc.pattern, tc.key)
+	}
+}
+
+func TestCopyObjectMetadata(t *testing.T) {
+	assert := assert.New(t)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nginx",
+			Namespace: "default",
+			Labels: map[string]string{
+				"team":                   "web",
+				"service":                "frontend",
+				"app.kubernetes.io/name": "nginx",
+				"pod-template-hash":      "bbd465f66",
+			},
+			Annotations: map[string]string{
+				"example.com/owner":                 "web@example.com",
+				"deployment.kubernetes.io/revision": "3",
+			},
+		},
+	}
+	cache := newObjectCache(fake.NewSimpleClientset(deployment))
+
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "Deployment"
+	k8sev.InvolvedObject.Name = "nginx"
+
+	plugin.CopyLabels = []string{"team", "service", "app.kubernetes.io/*"}
+	plugin.CopyAnnotations = []string{"example.com/*"}
+	plugin.CopyPrefix = "k8s_"
+	defer func() {
+		plugin.CopyLabels = []string{}
+		plugin.CopyAnnotations = []string{}
+		plugin.CopyPrefix = ""
+	}()
+
+	event := &corev2.Event{Check: &corev2.Check{}}
+	assert.NoError(copyObjectMetadata(event, k8sev, cache))
+	expected := map[string]string{
+		"k8s_team":                   "web",
+		"k8s_service":                "frontend",
+		"k8s_app.kubernetes.io/name": "nginx",
+		"k8s_example.com/owner":      "web@example.com",
+	}
+	assert.Equal(expected, event.ObjectMeta.Labels)
+	assert.Equal(expected, event.Check.ObjectMeta.Labels)
+
+	// Objects that no longer exist are skipped
+	k8sev.InvolvedObject.Name = "deleted"
+	event = &corev2.Event{Check: &corev2.Check{}}
+	assert.NoError(copyObjectMetadata(event, k8sev, cache))
+	assert.Empty(event.ObjectMeta.Labels)
+
+	// Unknown kinds are skipped
+	k8sev.InvolvedObject.Kind = "Widget"
+	event = &corev2.Event{Check: &corev2.Check{}}
+	assert.NoError(copyObjectMetadata(event, k8sev, cache))
+	assert.Empty(event.ObjectMeta.Labels)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// metricName is the name of the metric counting Kubernetes events.
+const metricName = "kubernetes_events"
+
+// metricKey identifies the Kubernetes events counted together.
+type metricKey struct {
+	Namespace string
+	Kind      string
+	Reason    string
+	Type      string
+}
+
+// tags returns the tags of the metric of a key, by name, in a stable order.
+func (k metricKey) tags() [][2]string {
+	tags := [][2]string{}
+	if len(plugin.Cluster) > 0 {
+		tags = append(tags, [2]string{"cluster", plugin.Cluster})
+	}
+	return append(tags,
+		[2]string{"namespace", k.Namespace},
+		[2]string{"kind", k.Kind},
+		[2]string{"reason", k.Reason},
+		[2]string{"type", k.Type},
+	)
+}
+
+// eventCounter counts the Kubernetes events of a check run by namespace,
+// kind, reason and type, to output them as metrics (see --metrics-format).
+type eventCounter struct {
+	counts map[metricKey]int
+}
+
+func newEventCounter() *eventCounter {
+	return &eventCounter{counts: make(map[metricKey]int)}
+}
+
+func (c *eventCounter) add(k8sEvent k8scorev1.Event) {
+	_, namespace, _ := entityObject(k8sEvent)
+	if len(namespace) == 0 {
+		namespace = "cluster"
+	}
+	c.counts[metricKey{
+		Namespace: namespace,
+		Kind:      k8sEvent.InvolvedObject.Kind,
+		Reason:    k8sEvent.Reason,
+		Type:      k8sEvent.Type,
+	}]++
+}
+
+var (
+	graphiteReplacer = strings.NewReplacer(".", "_", " ", "_", "/", "_")
+	influxReplacer   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	opentsdbInvalid  = regexp.MustCompile(`[^a-zA-Z0-9\-_./]`)
+	promReplacer     = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// metrics returns the event counts as lines of the given Sensu metric format
+// (graphite_plaintext, influxdb_line, opentsdb_line or prometheus_text).
+func (c *eventCounter) metrics(format string, now time.Time) []string {
+	keys := make([]metricKey, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Type < b.Type
+	})
+
+	lines := []string{}
+	if format == "prometheus_text" {
+		lines = append(lines, fmt.Sprintf("# TYPE %s gauge", metricName))
+	}
+	for _, key := range keys {
+		count := c.counts[key]
+		tags := key.tags()
+		switch format {
+		case "graphite_plaintext":
+			path := []string{metricName}
+			for _, tag := range tags {
+				path = append(path, graphiteReplacer.Replace(tag[1]))
+			}
+			lines = append(lines, fmt.Sprintf("%s %d %d", strings.Join(path, "."), count, now.Unix()))
+		case "influxdb_line":
+			fields := []string{metricName}
+			for _, tag := range tags {
+				if len(tag[1]) > 0 {
+					fields = append(fields, fmt.Sprintf("%s=%s", tag[0], influxReplacer.Replace(tag[1])))
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s value=%d %d", strings.Join(fields, ","), count, now.UnixNano()))
+		case "opentsdb_line":
+			fields := []string{}
+			for _, tag := range tags {
+				if len(tag[1]) > 0 {
+					fields = append(fields, fmt.Sprintf("%s=%s", tag[0], opentsdbInvalid.ReplaceAllString(tag[1], "_")))
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s %d %d %s", metricName, now.Unix(), count, strings.Join(fields, " ")))
+		case "prometheus_text":
+			labels := []string{}
+			for _, tag := range tags {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", tag[0], promReplacer.Replace(tag[1])))
+			}
+			lines = append(lines, fmt.Sprintf("%s{%s} %d", metricName, strings.Join(labels, ","), count))
+		}
+	}
+	return lines
+}
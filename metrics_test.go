@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func TestEventCounterMetrics(t *testing.T) {
+	plugin.Cluster = "prod"
+	defer func() { plugin.Cluster = "" }()
+
+	c := newEventCounter()
+	for _, ev := range [][]string{
+		{"Pod", "default", "BackOff", "Warning"},
+		{"Pod", "default", "BackOff", "Warning"},
+		{"Node", "", "Node Not Ready", "Warning"},
+	} {
+		k8sev := k8scorev1.Event{}
+		k8sev.InvolvedObject.Kind = ev[0]
+		k8sev.InvolvedObject.Namespace = ev[1]
+		k8sev.Reason = ev[2]
+		k8sev.Type = ev[3]
+		c.add(k8sev)
+	}
+	now := time.Unix(1600000000, 0)
+
+	testcases := []struct {
+		format   string
+		expected []string
+	}{
+		{
+			"graphite_plaintext",
+			[]string{
+				"kubernetes_events.prod.cluster.Node.Node_Not_Ready.Warning 1 1600000000",
+				"kubernetes_events.prod.default.Pod.BackOff.Warning 2 1600000000",
+			},
+		},
+		{
+			"influxdb_line",
+			[]string{
+				`kubernetes_events,cluster=prod,namespace=cluster,kind=Node,reason=Node\ Not\ Ready,type=Warning value=1 1600000000000000000`,
+				"kubernetes_events,cluster=prod,namespace=default,kind=Pod,reason=BackOff,type=Warning value=2 1600000000000000000",
+			},
+		},
+		{
+			"opentsdb_line",
+			[]string{
+				"kubernetes_events 1600000000 1 cluster=prod namespace=cluster kind=Node reason=Node_Not_Ready type=Warning",
+				"kubernetes_events 1600000000 2 cluster=prod namespace=default kind=Pod reason=BackOff type=Warning",
+			},
+		},
+		{
+			"prometheus_text",
+			[]string{
+				"# TYPE kubernetes_events gauge",
+				`kubernetes_events{cluster="prod",namespace="cluster",kind="Node",reason="Node Not Ready",type="Warning"} 1`,
+				`kubernetes_events{cluster="prod",namespace="default",kind="Pod",reason="BackOff",type="Warning"} 2`,
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		assert.Equal(t, tc.expected, c.metrics(tc.format, now), tc.format)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// namespaceMap is the parsed --sensu-namespace-map
+	namespaceMap map[string]string
+
+	// namespaceTemplate is the parsed --sensu-namespace-template
+	namespaceTemplate *template.Template
+)
+
+// parseNamespaceMap parses a JSON map of Kubernetes namespaces to Sensu
+// namespaces.
+func parseNamespaceMap(text string) (map[string]string, error) {
+	nsMap := map[string]string{}
+	if len(text) == 0 {
+		return nsMap, nil
+	}
+	if err := json.Unmarshal([]byte(text), &nsMap); err != nil {
+		return nil, fmt.Errorf("Failed to parse --sensu-namespace-map: %v", err)
+	}
+	return nsMap, nil
+}
+
+// sensuNamespace returns the Sensu namespace for the events created for a
+// Kubernetes event. The explicit --sensu-namespace-map is consulted first,
+// then the --sensu-namespace-label of the Kubernetes namespace, then the
+// --sensu-namespace-template. If none of them provides a namespace, the
+// namespace of the check is used.
+func sensuNamespace(k8sEvent k8scorev1.Event, cache *objectCache) (string, error) {
+	k8sNamespace := k8sEvent.InvolvedObject.Namespace
+	if len(k8sNamespace) == 0 {
+		k8sNamespace = k8sEvent.ObjectMeta.Namespace
+	}
+
+	if ns, ok := namespaceMap[k8sNamespace]; ok && len(ns) > 0 {
+		return ns, nil
+	}
+
+	if len(plugin.SensuNamespaceLabel) > 0 && len(k8sNamespace) > 0 {
+		ref := k8scorev1.ObjectReference{Kind: "Namespace", Name: k8sNamespace}
+		meta, err := cache.getObjectMeta(ref, "")
+		if err != nil {
+			return "", err
+		}
+		if meta != nil {
+			if ns := meta.Labels[plugin.SensuNamespaceLabel]; len(ns) > 0 {
+				return ns, nil
+			}
+		}
+	}
+
+	if namespaceTemplate != nil {
+		ns, err := executeTemplate(namespaceTemplate, k8sEvent)
+		if err != nil {
+			return "", err
+		}
+		if ns = strings.TrimSpace(ns); len(ns) > 0 {
+			return ns, nil
+		}
+	}
+
+	return plugin.SensuNamespace, nil
+}
+
+// routeNamespace sets the Sensu namespace of the event created for a
+// Kubernetes event. If it fails to be determined, the event is routed to the
+// namespace of the check, and the error returned.
+func routeNamespace(event *corev2.Event, k8sEvent k8scorev1.Event, cache *objectCache) error {
+	ns, err := sensuNamespace(k8sEvent, cache)
+	if err != nil {
+		ns = plugin.SensuNamespace
+	}
+	event.ObjectMeta.Namespace = ns
+	event.Check.ObjectMeta.Namespace = ns
+	return err
+}
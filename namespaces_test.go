@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseNamespaceMap(t *testing.T) {
+	assert := assert.New(t)
+	nsMap, err := parseNamespaceMap("")
+	assert.NoError(err)
+	assert.Empty(nsMap)
+	nsMap, err = parseNamespaceMap(`{"payments": "team-payments"}`)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"payments": "team-payments"}, nsMap)
+	_, err = parseNamespaceMap(`{"payments": `)
+	assert.Error(err)
+}
+
+func TestRouteNamespace(t *testing.T) {
+	cache := newObjectCache(fake.NewSimpleClientset(
+		&k8scorev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "checkout",
+			Labels: map[string]string{"sensu.io/namespace": "team-checkout"},
+		}},
+		&k8scorev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}},
+	))
+
+	var err error
+	plugin.SensuNamespace = "default"
+	plugin.SensuNamespaceLabel = "sensu.io/namespace"
+	namespaceMap = map[string]string{"payments": "team-payments"}
+	namespaceTemplate, err = parseTemplate("sensu-namespace-template", `{{if eq .Event.InvolvedObject.Namespace "kube-system"}}platform{{end}}`)
+	require.NoError(t, err)
+	defer func() {
+		plugin.SensuNamespaceLabel = ""
+		namespaceMap = nil
+		namespaceTemplate = nil
+	}()
+
+	testcases := []struct {
+		k8sNamespace   string
+		sensuNamespace string
+	}{
+		{"payments", "team-payments"},
+		{"checkout", "team-checkout"},
+		{"kube-system", "platform"},
+		{"unlabeled", "default"},
+		{"", "default"},
+	}
+	for _, tc := range testcases {
+		assert := assert.New(t)
+		k8sev := k8scorev1.Event{}
+		k8sev.ObjectMeta.Namespace = tc.k8sNamespace
+		k8sev.InvolvedObject.Namespace = tc.k8sNamespace
+		event := &corev2.Event{Check: &corev2.Check{}}
+		assert.NoError(routeNamespace(event, k8sev, cache))
+		assert.Equal(tc.sensuNamespace, event.ObjectMeta.Namespace)
+		assert.Equal(tc.sensuNamespace, event.Check.ObjectMeta.Namespace)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errUnsupportedKind is returned when looking up an object of a kind the
+// plugin doesn't know how to get.
+var errUnsupportedKind = errors.New("unsupported object kind")
+
+// objectCache caches the Kubernetes objects looked up while processing the
+// events of a single check run, so that many events for the same object only
+// result in a single API call.
+type objectCache struct {
+	client kubernetes.Interface
+	pods   map[string]*k8scorev1.Pod
+	metas  map[string]*metav1.ObjectMeta
+	nodes  []k8scorev1.Node
+}
+
+func newObjectCache(client kubernetes.Interface) *objectCache {
+	return &objectCache{
+		client: client,
+		pods:   make(map[string]*k8scorev1.Pod),
+		metas:  make(map[string]*metav1.ObjectMeta),
+	}
+}
+
+// getPod returns the named Pod, or nil if it no longer exists.
+func (c *objectCache) getPod(namespace, name string) (*k8scorev1.Pod, error) {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	if pod, ok := c.pods[key]; ok {
+		return pod, nil
+	}
+	pod, err := c.client.CoreV1().Pods(namespace).Get(apiContext, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		// Remember that the pod is gone so we don't keep asking for it
+		c.pods[key] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to get pod %s: %v", key, err)
+	}
+	c.pods[key] = pod
+	return pod, nil
+}
+
+// listNodes returns all the nodes of the cluster.
+func (c *objectCache) listNodes() ([]k8scorev1.Node, error) {
+	if c.nodes != nil {
+		return c.nodes, nil
+	}
+	nodes, err := c.client.CoreV1().Nodes().List(apiContext, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list nodes: %v", err)
+	}
+	c.nodes = nodes.Items
+	if c.nodes == nil {
+		c.nodes = []k8scorev1.Node{}
+	}
+	return c.nodes, nil
+}
+
+// getObjectMeta returns the metadata of the object referenced by an involved
+// object reference, or nil if the object no longer exists. errUnsupportedKind
+// is returned for kinds of objects that can't be looked up.
+func (c *objectCache) getObjectMeta(ref k8scorev1.ObjectReference, namespace string) (*metav1.ObjectMeta, error) {
+	if len(ref.Namespace) > 0 {
+		namespace = ref.Namespace
+	}
+	key := fmt.Sprintf("%s/%s/%s", ref.Kind, namespace, ref.Name)
+	if meta, ok := c.metas[key]; ok {
+		return meta, nil
+	}
+
+	var (
+		obj metav1.Object
+		err error
+	)
+	ctx := apiContext
+	opts := metav1.GetOptions{}
+	switch strings.ToLower(ref.Kind) {
+	case "pod":
+		var pod *k8scorev1.Pod
+		pod, err = c.getPod(namespace, ref.Name)
+		if pod != nil {
+			obj = pod
+		}
+	case "node":
+		obj, err = c.client.CoreV1().Nodes().Get(ctx, ref.Name, opts)
+	case "namespace":
+		obj, err = c.client.CoreV1().Namespaces().Get(ctx, ref.Name, opts)
+	case "service":
+		obj, err = c.client.CoreV1().Services(namespace).Get(ctx, ref.Name, opts)
+	case "endpoints":
+		obj, err = c.client.CoreV1().Endpoints(namespace).Get(ctx, ref.Name, opts)
+	case "persistentvolumeclaim":
+		obj, err = c.client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, ref.Name, opts)
+	case "persistentvolume":
+		obj, err = c.client.CoreV1().PersistentVolumes().Get(ctx, ref.Name, opts)
+	case "replicationcontroller":
+		obj, err = c.client.CoreV1().ReplicationControllers(namespace).Get(ctx, ref.Name, opts)
+	case "deployment":
+		obj, err = c.client.AppsV1().Deployments(namespace).Get(ctx, ref.Name, opts)
+	case "replicaset":
+		obj, err = c.client.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, opts)
+	case "statefulset":
+		obj, err = c.client.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, opts)
+	case "daemonset":
+		obj, err = c.client.AppsV1().DaemonSets(namespace).Get(ctx, ref.Name, opts)
+	case "job":
+		obj, err = c.client.BatchV1().Jobs(namespace).Get(ctx, ref.Name, opts)
+	case "cronjob":
+		obj, err = c.client.BatchV1beta1().CronJobs(namespace).Get(ctx, ref.Name, opts)
+	case "horizontalpodautoscaler":
+		obj, err = c.client.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(ctx, ref.Name, opts)
+	default:
+		return nil, errUnsupportedKind
+	}
+	if k8serrors.IsNotFound(err) {
+		c.metas[key] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to get %s %s: %v", ref.Kind, ref.Name, err)
+	}
+
+	var meta *metav1.ObjectMeta
+	if obj != nil {
+		meta = &metav1.ObjectMeta{
+			Name:            obj.GetName(),
+			Namespace:       obj.GetNamespace(),
+			UID:             obj.GetUID(),
+			Labels:          obj.GetLabels(),
+			Annotations:     obj.GetAnnotations(),
+			OwnerReferences: obj.GetOwnerReferences(),
+		}
+	}
+	c.metas[key] = meta
+	return meta, nil
+}
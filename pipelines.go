@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// processSettings are the settings that apply to the whole process, which
+// pipelines can't override.
+var processSettings = []string{
+	"config", "daemon", "external", "kubeconfig", "interval", "metrics-addr", "metrics-format",
+	"leader-elect", "shard", "dedup", "log", "shutdown", "spool", "batch",
+}
+
+// pipeline is a set of settings, with its parsed values, under which events
+// are processed. Without --config, the flags form a single pipeline.
+type pipeline struct {
+	config                   Config
+	gcGracePeriod            time.Duration
+	namespaceMap             map[string]string
+	namespaceTemplate        *template.Template
+	handlerRoutes            []handlerRoute
+	rollupThresholds         []rollupThreshold
+	outputTemplate           *template.Template
+	summaryTemplate          *template.Template
+	dedupTTL                 time.Duration
+	leaderElectLeaseDuration time.Duration
+}
+
+// pipelines are the pipelines of the check, set by checkArgs.
+var pipelines []*pipeline
+
+// capturePipeline captures the current (validated) settings as a pipeline.
+func capturePipeline() *pipeline {
+	return &pipeline{
+		config:                   plugin,
+		gcGracePeriod:            gcGracePeriod,
+		namespaceMap:             namespaceMap,
+		namespaceTemplate:        namespaceTemplate,
+		handlerRoutes:            handlerRoutes,
+		rollupThresholds:         rollupThresholds,
+		outputTemplate:           outputTemplate,
+		summaryTemplate:          summaryTemplate,
+		dedupTTL:                 dedupTTL,
+		leaderElectLeaseDuration: leaderElectLeaseDuration,
+	}
+}
+
+// activate makes the settings of the pipeline the current settings.
+func (p *pipeline) activate() {
+	plugin = p.config
+	gcGracePeriod = p.gcGracePeriod
+	namespaceMap = p.namespaceMap
+	namespaceTemplate = p.namespaceTemplate
+	handlerRoutes = p.handlerRoutes
+	rollupThresholds = p.rollupThresholds
+	outputTemplate = p.outputTemplate
+	summaryTemplate = p.summaryTemplate
+	dedupTTL = p.dedupTTL
+	leaderElectLeaseDuration = p.leaderElectLeaseDuration
+}
+
+// pipelineFile is the --config file.
+type pipelineFile struct {
+	Pipelines []map[string]interface{} `json:"pipelines"`
+}
+
+// loadPipelines loads the pipelines of a --config file. Each pipeline has a
+// name, and settings named like the flags, overriding the flags.
+func loadPipelines(path string) ([]*pipeline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read --config: %v", err)
+	}
+	file := pipelineFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Failed to parse --config %s: %v", path, err)
+	}
+	if len(file.Pipelines) == 0 {
+		return nil, fmt.Errorf("No pipelines in --config %s", path)
+	}
+
+	base := plugin
+	defer func() { plugin = base }()
+	loaded := []*pipeline{}
+	names := map[string]bool{}
+	for i, settings := range file.Pipelines {
+		name, _ := settings["name"].(string)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("Pipeline %d of --config has no name", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("Pipeline %s of --config is defined twice", name)
+		}
+		names[name] = true
+
+		plugin = base
+		plugin.Pipeline = name
+		for key, value := range settings {
+			if key == "name" {
+				continue
+			}
+			if err := applySetting(key, value); err != nil {
+				return nil, fmt.Errorf("Pipeline %s of --config: %v", name, err)
+			}
+		}
+		if _, err := validateConfig(); err != nil {
+			return nil, fmt.Errorf("Pipeline %s of --config: %v", name, err)
+		}
+		loaded = append(loaded, capturePipeline())
+	}
+	return loaded, nil
+}
+
+// applySetting sets the flag named key, from its YAML value.
+func applySetting(key string, value interface{}) error {
+	for _, setting := range processSettings {
+		if key == setting || strings.HasPrefix(key, setting+"-") {
+			return fmt.Errorf("%s applies to all pipelines and can only be set as a flag", key)
+		}
+	}
+
+	var option *sensu.PluginConfigOption
+	for _, opt := range options {
+		if opt.Argument == key {
+			option = opt
+		}
+	}
+	if option == nil {
+		return fmt.Errorf("unknown setting %s", key)
+	}
+
+	invalid := fmt.Errorf("invalid value %v for %s", value, key)
+	switch v := option.Value.(type) {
+	case *string:
+		switch value := value.(type) {
+		case string:
+			*v = value
+		default:
+			// Settings taking JSON (e.g. status-map) can be given as YAML
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return invalid
+			}
+			*v = string(encoded)
+		}
+	case *bool:
+		b, ok := value.(bool)
+		if !ok {
+			return invalid
+		}
+		*v = b
+	case *int:
+		n, ok := value.(float64)
+		if !ok {
+			return invalid
+		}
+		*v = int(n)
+	case *uint32:
+		n, ok := value.(float64)
+		if !ok || n < 0 {
+			return invalid
+		}
+		*v = uint32(n)
+	case *[]string:
+		switch value := value.(type) {
+		case string:
+			*v = []string{value}
+		case []interface{}:
+			values := []string{}
+			for _, item := range value {
+				s, ok := item.(string)
+				if !ok {
+					return invalid
+				}
+				values = append(values, s)
+			}
+			*v = values
+		default:
+			return invalid
+		}
+	default:
+		return fmt.Errorf("%s can't be set in --config", key)
+	}
+	return nil
+}
+
+// eventListOptions returns the options listing the events selected by the
+// current settings.
+func eventListOptions() metav1.ListOptions {
+	var fieldSelectors []string
+
+	if len(plugin.EventType) > 0 {
+		// The plugin.EventType should include its operator (=/!=) that's why the
+		// the string is abutted to the type string below
+		fieldSelectors = append(fieldSelectors, fmt.Sprintf("type%s", plugin.EventType))
+	}
+
+	if len(plugin.ObjectKind) > 0 {
+		fieldSelectors = append(fieldSelectors, fmt.Sprintf("involvedObject.kind=%s", plugin.ObjectKind))
+	}
+
+	listOptions := metav1.ListOptions{}
+
+	if len(fieldSelectors) > 0 {
+		listOptions.FieldSelector = strings.Join(fieldSelectors, ",")
+	}
+
+	if len(plugin.LabelSelectors) > 0 {
+		listOptions.LabelSelector = plugin.LabelSelectors
+	}
+
+	return listOptions
+}
+
+// sharedListOptions returns the namespace and options of the single List (or
+// Watch) serving all pipelines: the selectors they share, if any.
+func sharedListOptions(pipelines []*pipeline) (string, metav1.ListOptions) {
+	var (
+		namespace   string
+		listOptions metav1.ListOptions
+	)
+	for i, p := range pipelines {
+		p.activate()
+		options := eventListOptions()
+		if i == 0 {
+			namespace = plugin.Namespace
+			listOptions = options
+			continue
+		}
+		if plugin.Namespace != namespace {
+			namespace = ""
+		}
+		if options.FieldSelector != listOptions.FieldSelector {
+			listOptions.FieldSelector = ""
+		}
+		if options.LabelSelector != listOptions.LabelSelector {
+			listOptions.LabelSelector = ""
+		}
+	}
+	return namespace, listOptions
+}
+
+// eventSelected reports whether a Kubernetes event is selected by the
+// namespace and selectors of the current settings, for events listed for
+// several pipelines.
+func eventSelected(k8sEvent k8scorev1.Event) (bool, error) {
+	if len(plugin.Namespace) > 0 && k8sEvent.Namespace != plugin.Namespace {
+		return false, nil
+	}
+	if strings.HasPrefix(plugin.EventType, "!=") {
+		if k8sEvent.Type == strings.TrimPrefix(plugin.EventType, "!=") {
+			return false, nil
+		}
+	} else if len(plugin.EventType) > 0 && k8sEvent.Type != strings.TrimPrefix(plugin.EventType, "=") {
+		return false, nil
+	}
+	if len(plugin.ObjectKind) > 0 && k8sEvent.InvolvedObject.Kind != plugin.ObjectKind {
+		return false, nil
+	}
+	if len(plugin.LabelSelectors) > 0 {
+		selector, err := labels.Parse(plugin.LabelSelectors)
+		if err != nil {
+			return false, fmt.Errorf("Failed to parse --label-selectors: %v", err)
+		}
+		if !selector.Matches(labels.Set(k8sEvent.Labels)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func writePipelines(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "pipelines")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "pipelines.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadPipelines(t *testing.T) {
+	assert := assert.New(t)
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.AgentAPIURL = "http://127.0.0.1:3031/events"
+	plugin.Namespace = "default"
+	plugin.EventType = ""
+	plugin.Handlers = []string{"slack"}
+
+	path := writePipelines(t, `
+pipelines:
+- name: warnings
+  event-type: "!=Normal"
+  namespace: all
+  status-map:
+    warning: 2
+  handlers: [pagerduty, slack]
+- name: pods
+  object-kind: Pod
+  handlers: email
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	loaded, err := loadPipelines(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal("default", plugin.Namespace)
+
+	warnings := loaded[0].config
+	assert.Equal("warnings", warnings.Pipeline)
+	assert.Equal("!=Normal", warnings.EventType)
+	assert.Equal("", warnings.Namespace)
+	assert.JSONEq(`{"warning":2}`, warnings.StatusMap)
+	assert.Equal([]string{"pagerduty", "slack"}, warnings.Handlers)
+
+	pods := loaded[1].config
+	assert.Equal("pods", pods.Pipeline)
+	assert.Equal("", pods.EventType)
+	assert.Equal("Pod", pods.ObjectKind)
+	assert.Equal("default", pods.Namespace)
+	assert.Equal([]string{"email"}, pods.Handlers)
+
+	namespace, listOptions := sharedListOptions(loaded)
+	assert.Equal("", namespace)
+	assert.Equal("", listOptions.FieldSelector)
+}
+
+func TestLoadPipelinesErrors(t *testing.T) {
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.AgentAPIURL = "http://127.0.0.1:3031/events"
+
+	testCases := map[string]string{
+		"empty":          `pipelines: []`,
+		"no name":        "pipelines:\n- object-kind: Pod",
+		"duplicate name": "pipelines:\n- name: a\n- name: a",
+		"unknown":        "pipelines:\n- name: a\n  unknown: b",
+		"process":        "pipelines:\n- name: a\n  daemon: true",
+		"invalid value":  "pipelines:\n- name: a\n  enrich-pods: yes please",
+		"invalid config": "pipelines:\n- name: a\n  sink: nowhere",
+	}
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := writePipelines(t, content)
+			defer os.RemoveAll(filepath.Dir(path))
+			_, err := loadPipelines(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEventSelected(t *testing.T) {
+	base := plugin
+	defer func() { plugin = base }()
+
+	k8sev := k8scorev1.Event{}
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.Labels = map[string]string{"app": "nginx"}
+
+	testCases := []struct {
+		namespace string
+		eventType string
+		kind      string
+		labels    string
+		selected  bool
+	}{
+		{"", "", "", "", true},
+		{"default", "=Warning", "Pod", "app=nginx", true},
+		{"kube-system", "", "", "", false},
+		{"", "=Normal", "", "", false},
+		{"", "!=Normal", "", "", true},
+		{"", "!=Warning", "", "", false},
+		{"", "", "Node", "", false},
+		{"", "", "", "app!=nginx", false},
+	}
+	for _, tc := range testCases {
+		plugin.Namespace = tc.namespace
+		plugin.EventType = tc.eventType
+		plugin.ObjectKind = tc.kind
+		plugin.LabelSelectors = tc.labels
+		selected, err := eventSelected(k8sev)
+		require.NoError(t, err)
+		assert.Equal(t, tc.selected, selected, "%+v", tc)
+	}
+}
+
+func TestOptionsEnv(t *testing.T) {
+	// e.g. --config must not read the kubeconfig of KUBERNETES_CONFIG
+	seen := map[string]string{}
+	for _, option := range options {
+		if len(option.Env) == 0 {
+			continue
+		}
+		other, ok := seen[option.Env]
+		assert.False(t, ok, "%s and %s share %s", other, option.Argument, option.Env)
+		seen[option.Env] = option.Argument
+	}
+}
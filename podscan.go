@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// scanComponent is the source of the events created by scanning Pods.
+const scanComponent = "sensu-kubernetes-events"
+
+// scanWaitingReasons maps the waiting reasons of containers that are stuck to
+// the reason naming the events of the kubelet about them: BackOff, Failed
+// with an "Error: <reason>" message, or Failed.
+var scanWaitingReasons = map[string]string{
+	"CrashLoopBackOff":           "BackOff",
+	"ImagePullBackOff":           "ImagePullBackOff",
+	"ErrImagePull":               "ErrImagePull",
+	"InvalidImageName":           "InvalidImageName",
+	"CreateContainerConfigError": "Failed",
+	"CreateContainerError":       "Failed",
+	"RunContainerError":          "Failed",
+}
+
+// scanPods lists the Pods of the namespace and returns an event for each
+// container problem found in their status (see --scan-pods), as Kubernetes
+// events about it may have expired or be older than the check interval. Like
+// listed events, the events are selected by the type, kind and label selectors
+// of the current settings.
+func (p *eventProcessor) scanPods(now time.Time) ([]k8scorev1.Event, error) {
+	pods, err := p.cache.client.CoreV1().Pods(plugin.Namespace).List(apiContext, metav1.ListOptions{})
+	if err != nil {
+		telemetry.apiError("kubernetes")
+		return nil, fmt.Errorf("Failed to list pods: %v", err)
+	}
+	events := []k8scorev1.Event{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Enrichment and metadata copies look the Pod up
+		p.cache.pods[fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)] = pod
+		problems := []k8scorev1.Event{}
+		for _, status := range pod.Status.InitContainerStatuses {
+			problems = append(problems, containerProblems(pod, status, fmt.Sprintf("spec.initContainers{%s}", status.Name), now)...)
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			problems = append(problems, containerProblems(pod, status, fmt.Sprintf("spec.containers{%s}", status.Name), now)...)
+		}
+		for _, k8sEvent := range problems {
+			selected, err := eventSelected(k8sEvent)
+			if err != nil {
+				return nil, err
+			}
+			if !selected {
+				eventLog(k8sEvent).WithField("filter", "pipeline").Debug("Event filtered: not selected by the pipeline")
+				continue
+			}
+			events = append(events, k8sEvent)
+		}
+	}
+	return events, nil
+}
+
+// containerProblems returns the events of the problems of a container, at the
+// given field path: stuck waiting, or within the check interval, killed for
+// running out of memory or restarted too often. Terminations before the
+// interval were reported by earlier runs.
+func containerProblems(pod *k8scorev1.Pod, status k8scorev1.ContainerStatus, fieldPath string, now time.Time) []k8scorev1.Event {
+	since := now.Add(-time.Duration(plugin.Interval) * time.Second)
+	recent := func(terminated *k8scorev1.ContainerStateTerminated) bool {
+		return terminated != nil && terminated.FinishedAt.After(since)
+	}
+
+	events := []k8scorev1.Event{}
+	if waiting := status.State.Waiting; waiting != nil && len(scanWaitingReasons[waiting.Reason]) > 0 {
+		message := fmt.Sprintf("Container %s is waiting: %s", status.Name, waiting.Reason)
+		if len(waiting.Message) > 0 {
+			message = fmt.Sprintf("%s: %s", message, waiting.Message)
+		}
+		events = append(events, scannedEvent(pod, status, fieldPath, scanWaitingReasons[waiting.Reason], message, now))
+	}
+
+	terminated := status.State.Terminated
+	if terminated == nil {
+		terminated = status.LastTerminationState.Terminated
+	}
+	if recent(terminated) && terminated.Reason == "OOMKilled" {
+		message := fmt.Sprintf("Container %s was OOMKilled (exit code %d) at %s", status.Name, terminated.ExitCode, terminated.FinishedAt.Format(time.RFC3339))
+		events = append(events, scannedEvent(pod, status, fieldPath, terminated.Reason, message, now))
+	}
+
+	last := status.LastTerminationState.Terminated
+	if plugin.ScanPodsRestarts > 0 && int(status.RestartCount) >= plugin.ScanPodsRestarts && recent(last) {
+		message := fmt.Sprintf("Container %s restarted %d times, last at %s", status.Name, status.RestartCount, last.FinishedAt.Format(time.RFC3339))
+		events = append(events, scannedEvent(pod, status, fieldPath, "Restarts", message, now))
+	}
+	return events
+}
+
+// scannedEvent returns a Kubernetes event for a container problem, about the
+// container (or init container) like the events of the kubelet, for the Sensu
+// event to be named like theirs by createSensuEvent:
+// container-<container_name>-<reason>. Its count is the restart count of the
+// container, so that deduplication (see --dedup) sends it again on each
+// restart.
+func scannedEvent(pod *k8scorev1.Pod, status k8scorev1.ContainerStatus, fieldPath, reason, message string, now time.Time) k8scorev1.Event {
+	k8sEvent := k8scorev1.Event{}
+	k8sEvent.Name = strings.ToLower(fmt.Sprintf("%s.%s-%s", pod.Name, status.Name, reason))
+	k8sEvent.Namespace = pod.Namespace
+	k8sEvent.UID = types.UID(fmt.Sprintf("%s-%s-%s", pod.UID, status.Name, strings.ToLower(reason)))
+	k8sEvent.InvolvedObject = k8scorev1.ObjectReference{
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+		APIVersion: "v1",
+		FieldPath:  fieldPath,
+	}
+	k8sEvent.Reason = reason
+	k8sEvent.Message = message
+	k8sEvent.Type = k8scorev1.EventTypeWarning
+	k8sEvent.Count = status.RestartCount
+	k8sEvent.Source.Component = scanComponent
+	k8sEvent.FirstTimestamp = metav1.NewTime(now)
+	k8sEvent.LastTimestamp = metav1.NewTime(now)
+	return k8sEvent
+}
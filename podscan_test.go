@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestScanPods(t *testing.T) {
+	assert := assert.New(t)
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.Namespace = ""
+	plugin.EventType = ""
+	plugin.ObjectKind = ""
+	plugin.LabelSelectors = ""
+	plugin.ScanPodsRestarts = 5
+	plugin.Interval = 60
+	now := time.Now()
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+
+	pod := &k8scorev1.Pod{}
+	pod.Name = "nginx-1234"
+	pod.Namespace = "default"
+	pod.UID = "abc"
+	pod.Status.ContainerStatuses = []k8scorev1.ContainerStatus{
+		{
+			Name:         "nginx",
+			RestartCount: 7,
+			State: k8scorev1.ContainerState{
+				Waiting: &k8scorev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 5m0s restarting failed container"},
+			},
+			LastTerminationState: k8scorev1.ContainerState{
+				Terminated: &k8scorev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137, FinishedAt: metav1.NewTime(now.Add(-30 * time.Second))},
+			},
+		},
+		{
+			// Killed and restarted long ago, reported by earlier runs
+			Name:         "worker",
+			RestartCount: 9,
+			State:        k8scorev1.ContainerState{Running: &k8scorev1.ContainerStateRunning{}},
+			LastTerminationState: k8scorev1.ContainerState{
+				Terminated: &k8scorev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137, FinishedAt: metav1.NewTime(now.Add(-24 * time.Hour))},
+			},
+		},
+		{
+			Name:  "sidecar",
+			State: k8scorev1.ContainerState{Running: &k8scorev1.ContainerStateRunning{}},
+		},
+		{
+			Name:  "starting",
+			State: k8scorev1.ContainerState{Waiting: &k8scorev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		},
+	}
+	pod.Status.InitContainerStatuses = []k8scorev1.ContainerStatus{
+		{
+			Name:         "init",
+			RestartCount: 7,
+			State: k8scorev1.ContainerState{
+				Waiting: &k8scorev1.ContainerStateWaiting{Reason: "CreateContainerConfigError", Message: `configmap "init" not found`},
+			},
+		},
+	}
+	healthy := &k8scorev1.Pod{}
+	healthy.Name = "redis-5678"
+	healthy.Namespace = "default"
+
+	processor, err := newEventProcessor(fake.NewSimpleClientset(pod, healthy))
+	require.NoError(t, err)
+	scanned, err := processor.scanPods(now)
+	require.NoError(t, err)
+	require.Len(t, scanned, 4)
+
+	checks := []string{}
+	for _, k8sev := range scanned {
+		assert.Equal(int32(7), k8sev.Count)
+		assert.Equal(metav1.NewTime(now), k8sev.FirstTimestamp)
+		event, err := createSensuEvent(k8sev)
+		require.NoError(t, err)
+		assert.Equal("nginx-1234", event.Check.ProxyEntityName)
+		assert.Equal(uint32(1), event.Check.Status)
+		checks = append(checks, event.Check.ObjectMeta.Name)
+	}
+	// Named like the events of the kubelet
+	assert.Equal([]string{"container-init-failed", "container-nginx-backoff", "container-nginx-oomkilled", "container-nginx-restarts"}, checks)
+	assert.Equal("spec.initContainers{init}", scanned[0].InvolvedObject.FieldPath)
+	assert.Equal(`Container init is waiting: CreateContainerConfigError: configmap "init" not found`, scanned[0].Message)
+	assert.Equal("spec.containers{nginx}", scanned[1].InvolvedObject.FieldPath)
+	assert.Equal("Container nginx is waiting: CrashLoopBackOff: back-off 5m0s restarting failed container", scanned[1].Message)
+	assert.Contains(scanned[2].Message, "exit code 137")
+
+	// The scanned Pods are cached for enrichment
+	cached, err := processor.cache.getPod("default", "nginx-1234")
+	require.NoError(t, err)
+	assert.Equal(pod.UID, cached.UID)
+
+	plugin.ScanPodsRestarts = 0
+	scanned, err = processor.scanPods(now)
+	require.NoError(t, err)
+	assert.Len(scanned, 3)
+
+	// Pipelines only get the events they select
+	plugin.EventType = "=Normal"
+	scanned, err = processor.scanPods(now)
+	require.NoError(t, err)
+	assert.Empty(scanned)
+	plugin.EventType = ""
+	plugin.ObjectKind = "Node"
+	scanned, err = processor.scanPods(now)
+	require.NoError(t, err)
+	assert.Empty(scanned)
+}
+
+func TestRunPipelineScanFailure(t *testing.T) {
+	posted := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer test.Close()
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.AgentAPIURL = test.URL
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.EventType = ""
+	plugin.ObjectKind = ""
+	plugin.LabelSelectors = ""
+	plugin.Interval = 60
+	plugin.Aggregate = "namespace"
+	plugin.ScanPods = true
+
+	// The service account may not be allowed to list Pods
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	})
+	k8sev := k8scorev1.Event{}
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.Reason = "BackOff"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	k8sev.FirstTimestamp = metav1.Now()
+
+	// The events of the run are still flushed
+	status, err := runPipeline(clientset, []k8scorev1.Event{k8sev})
+	require.NoError(t, err)
+	assert.Equal(t, sensu.CheckStateWarning, status)
+	assert.Equal(t, 1, posted)
+}
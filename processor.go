@@ -0,0 +1,290 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/sirupsen/logrus"
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventProcessor turns Kubernetes events into Sensu events, holding the state
+// shared by all the events of a check run.
+type eventProcessor struct {
+	cache       *objectCache
+	sensuClient *sensuAPIClient
+	upserter    *entityUpserter
+	silencer    *silencer
+	limiter     *stormLimiter
+	aggregator  *aggregator
+	rollup      *healthRollup
+	metrics     *eventCounter
+	dedup       *deduplicator
+	spool       *spoolingSink
+	sink        eventSink
+
+	// namespaces are the Sensu namespaces events were routed to
+	namespaces map[string]bool
+	// skipped counts the events that were skipped, by reason
+	skipped map[string]int
+}
+
+func newEventProcessor(clientset kubernetes.Interface) (*eventProcessor, error) {
+	p := &eventProcessor{
+		cache:      newObjectCache(clientset),
+		namespaces: map[string]bool{plugin.SensuNamespace: true},
+		skipped:    make(map[string]int),
+		limiter:    newStormLimiter(),
+	}
+	for _, ns := range namespaceMap {
+		p.namespaces[ns] = true
+	}
+
+	if plugin.UpsertEntities || plugin.GCEntities || plugin.Sink == "backend" || plugin.SilenceAction == "silence" {
+		client, err := newSensuAPIClient()
+		if err != nil {
+			return nil, err
+		}
+		p.sensuClient = client
+	}
+	if plugin.UpsertEntities {
+		p.upserter = newEntityUpserter(p.sensuClient)
+	}
+	if plugin.SilenceAction != "none" && len(plugin.SilenceAction) > 0 {
+		p.silencer = newSilencer(p.cache, p.sensuClient)
+	}
+	if plugin.Aggregate == "workload" || plugin.Aggregate == "namespace" {
+		p.aggregator = newAggregator(p.cache)
+	}
+	if plugin.Rollup {
+		p.rollup = newHealthRollup(rollupThresholds)
+	}
+	if plugin.MetricsFormat != "none" && len(plugin.MetricsFormat) > 0 {
+		p.metrics = newEventCounter()
+	}
+	if plugin.Dedup != "none" && len(plugin.Dedup) > 0 {
+		if sharedDeduplicator == nil {
+			sharedDeduplicator = newDeduplicator(newDedupStore(clientset), dedupTTL, plugin.DedupMaxEntries)
+		}
+		p.dedup = sharedDeduplicator
+	}
+	sink := newEventSink(p.sensuClient)
+	if batch, ok := sink.(batchSink); ok && plugin.BatchSize > 1 {
+		// The agent and backend APIs take one event per request
+		p.sink = newBatchingSink(batch, plugin.BatchSize, batchWait)
+	} else {
+		p.sink = instrumentedSink{sink: sink}
+	}
+	if len(plugin.SpoolDir) > 0 {
+		p.spool = newSpoolingSink(p.sink, eventSpool{dir: spoolDir(), max: plugin.SpoolMaxEvents})
+		p.sink = p.spool
+	}
+	return p, nil
+}
+
+// process creates the Sensu event for a Kubernetes event. It returns a nil
+// event if the event should not be sent.
+func (p *eventProcessor) process(k8sEvent k8scorev1.Event) (*corev2.Event, error) {
+	telemetry.eventReceived()
+	if p.dedup != nil {
+		seen, err := p.dedup.seen(k8sEvent)
+		if err != nil {
+			return nil, err
+		}
+		if seen {
+			p.skip(k8sEvent, "duplicate")
+			return nil, nil
+		}
+	}
+	event, err := createSensuEvent(k8sEvent)
+	if err != nil {
+		return nil, err
+	}
+	// The lookups below only add to the event, their failures (e.g. RBAC
+	// forbidding a get) are logged and the event is forwarded without them
+	if plugin.EnrichPods {
+		if err := enrichPodEvent(event, k8sEvent, p.cache); err != nil {
+			lookupFailed(k8sEvent, "enrich event", err)
+		}
+	}
+	if err := copyObjectMetadata(event, k8sEvent, p.cache); err != nil {
+		lookupFailed(k8sEvent, "copy object metadata", err)
+	}
+	if err := routeNamespace(event, k8sEvent, p.cache); err != nil {
+		lookupFailed(k8sEvent, "route Sensu namespace", err)
+	}
+	if p.silencer != nil {
+		skip, err := p.silencer.apply(event, k8sEvent, time.Now())
+		if err != nil {
+			lookupFailed(k8sEvent, "apply silencing", err)
+		}
+		if skip {
+			p.skip(k8sEvent, "silenced")
+			return nil, nil
+		}
+	}
+	if plugin.DrainAction == "skip" || plugin.DrainAction == "downgrade" {
+		churn, err := drainChurn(k8sEvent, p.cache)
+		if err != nil {
+			lookupFailed(k8sEvent, "check node drains", err)
+		}
+		if churn && plugin.DrainAction == "skip" {
+			p.skip(k8sEvent, "draining")
+			return nil, nil
+		} else if churn {
+			event.Check.Status = downgradeStatus(event.Check.Status)
+			eventLog(k8sEvent).WithField("status", event.Check.Status).Debug("Event downgraded: node draining")
+		}
+	}
+	p.namespaces[event.ObjectMeta.Namespace] = true
+	routeHandlers(event, k8sEvent)
+	if p.rollup != nil {
+		// Events suppressed by the limits still count towards cluster health
+		p.rollup.add(event, k8sEvent)
+	}
+	if !p.limiter.allow(event, k8sEvent) {
+		telemetry.eventFiltered("suppressed")
+		return nil, nil
+	}
+	telemetry.eventMapped()
+	eventLog(k8sEvent).WithFields(logrus.Fields{
+		"namespace": event.ObjectMeta.Namespace,
+		"entity":    event.Check.ProxyEntityName,
+		"check":     event.Check.ObjectMeta.Name,
+		"status":    event.Check.Status,
+		"handlers":  strings.Join(event.Check.Handlers, ","),
+	}).Debug("Event mapped")
+	return event, nil
+}
+
+// lookupFailed logs the failure of an optional lookup, the event being
+// forwarded without what it would have added.
+func lookupFailed(k8sEvent k8scorev1.Event, what string, err error) {
+	eventLog(k8sEvent).WithError(err).Warnf("Failed to %s, forwarding the event as is", what)
+}
+
+// skip records an event skipped for the given reason.
+func (p *eventProcessor) skip(k8sEvent k8scorev1.Event, reason string) {
+	eventLog(k8sEvent).WithField("filter", reason).Debug("Event filtered")
+	p.skipped[reason]++
+	telemetry.eventFiltered(reason)
+}
+
+// handle processes a Kubernetes event and sends (or aggregates) the resulting
+// Sensu event. It returns the summary of the event, or an empty string if it
+// was not sent.
+func (p *eventProcessor) handle(k8sEvent k8scorev1.Event) (string, error) {
+	if p.metrics != nil {
+		p.metrics.add(k8sEvent)
+	}
+	event, err := p.process(k8sEvent)
+	if err != nil {
+		return "", err
+	}
+	if event == nil {
+		return "", nil
+	}
+	summary, err := eventSummary(k8sEvent)
+	if err != nil {
+		return "", err
+	}
+	if p.aggregator != nil {
+		// Recorded as forwarded once its group is delivered by flush
+		eventLog(k8sEvent).WithField("aggregate", plugin.Aggregate).Debug("Event aggregated")
+		if err := p.aggregator.add(event, k8sEvent); err != nil {
+			return "", err
+		}
+		return summary, nil
+	}
+	if err := p.submit(event, k8sEvent); err != nil {
+		return "", err
+	}
+	if p.dedup != nil {
+		p.dedup.record(k8sEvent, time.Now())
+	}
+	return summary, nil
+}
+
+// flush sends the events aggregated over the run, by --aggregate and by the
+// event storm limits. It returns the output of the latter.
+func (p *eventProcessor) flush() ([]string, error) {
+	if p.aggregator != nil {
+		for _, summary := range p.aggregator.events() {
+			if err := p.submitSummary(summary); err != nil {
+				return nil, err
+			}
+			if p.dedup != nil {
+				for _, k8sEvent := range summary.sources {
+					p.dedup.record(k8sEvent, time.Now())
+				}
+			}
+		}
+	}
+
+	output := []string{}
+	for _, summary := range p.limiter.aggregated() {
+		output = append(output, strings.TrimSpace(summary.Check.Output))
+		if err := p.submitSummary(summary); err != nil {
+			return output, err
+		}
+	}
+	if err := p.flushBatch(); err != nil {
+		return output, err
+	}
+	if p.spool != nil {
+		output = append(output, p.spool.flush()...)
+	}
+	if p.dedup != nil {
+		if err := p.dedup.save(time.Now()); err != nil {
+			return output, err
+		}
+	}
+	return output, nil
+}
+
+// flushBatch delivers the events queued for batching, if any.
+func (p *eventProcessor) flushBatch() error {
+	if f, ok := p.sink.(batchFlusher); ok {
+		return f.flushBatch()
+	}
+	return nil
+}
+
+// submit sends a Sensu event, upserting its proxy entity first if requested.
+// Like the lookups of process, upserting only adds to the entity: its failure
+// is logged and the event is sent.
+func (p *eventProcessor) submit(event *corev2.Event, k8sEvent k8scorev1.Event) error {
+	if p.upserter != nil {
+		if err := p.upserter.upsert(event, entityReference(k8sEvent)); err != nil {
+			lookupFailed(k8sEvent, "upsert proxy entity", err)
+		}
+	}
+	return p.sink.submit(event)
+}
+
+// submitSummary sends a summary event like submit, upserting the proxy entity
+// of its workload, namespace or cluster first if requested.
+func (p *eventProcessor) submitSummary(summary summaryEvent) error {
+	if p.upserter != nil {
+		if err := p.upserter.upsert(summary.Event, summary.object); err != nil {
+			pipelineLog().WithField("entity", summary.Check.ProxyEntityName).WithError(err).Warn("Failed to upsert proxy entity, forwarding the event as is")
+		}
+	}
+	return p.sink.submit(summary.Event)
+}
+
+// collectEntities garbage collects the stale proxy entities of all the Sensu
+// namespaces events may have been routed to.
+func (p *eventProcessor) collectEntities() ([]string, error) {
+	collected := []string{}
+	for ns := range p.namespaces {
+		nsCollected, err := collectEntities(p.sensuClient, p.cache, ns, gcGracePeriod, time.Now())
+		collected = append(collected, nsCollected...)
+		if err != nil {
+			return collected, err
+		}
+	}
+	return collected, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configPollPeriod is how often the --config file is checked for changes in
+// daemon mode.
+const configPollPeriod = 5 * time.Second
+
+// flagConfig is the configuration from the flags, which the pipelines of the
+// --config file override.
+var flagConfig Config
+
+// reloadPipelines loads the pipelines of the --config file again.
+func reloadPipelines() ([]*pipeline, error) {
+	plugin = flagConfig
+	return loadPipelines(flagConfig.ConfigFile)
+}
+
+// configWatcher detects changes to the --config file by its content, as a
+// mounted ConfigMap is updated by swapping symlinks rather than writing the
+// file.
+type configWatcher struct {
+	path string
+	sum  [sha256.Size]byte
+}
+
+func newConfigWatcher(path string) *configWatcher {
+	w := &configWatcher{path: path}
+	w.changed()
+	return w
+}
+
+// changed reports whether the file changed since it was last checked. A file
+// that can't be read counts as a change, for the reload to report the error.
+func (w *configWatcher) changed() bool {
+	var sum [sha256.Size]byte
+	if data, err := ioutil.ReadFile(w.path); err == nil {
+		sum = sha256.Sum256(data)
+	}
+	if sum == w.sum {
+		return false
+	}
+	w.sum = sum
+	return true
+}
+
+// configReloads returns a channel receiving a value whenever the --config file
+// must be reloaded, when it changes or on SIGHUP, until stopped. Without
+// --config, the channel never receives.
+func configReloads(path string, stop <-chan struct{}) <-chan struct{} {
+	if len(path) == 0 {
+		return nil
+	}
+	reloads := make(chan struct{}, 1)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	watcher := newConfigWatcher(path)
+
+	go func() {
+		defer signal.Stop(hangups)
+		ticker := time.NewTicker(configPollPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hangups:
+				// Reload even if the file didn't change, e.g. to retry
+				watcher.changed()
+			case <-ticker.C:
+				if !watcher.changed() {
+					continue
+				}
+			case <-stop:
+				return
+			}
+			select {
+			case reloads <- struct{}{}:
+			default:
+				// A reload is already pending
+			}
+		}
+	}()
+	return reloads
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pipelines.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines: []"), 0644))
+
+	w := newConfigWatcher(path)
+	assert.False(w.changed())
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines: []"), 0644))
+	assert.False(w.changed())
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines:\n- name: a"), 0644))
+	assert.True(w.changed())
+	assert.False(w.changed())
+	require.NoError(t, os.Remove(path))
+	assert.True(w.changed())
+	assert.False(w.changed())
+}
+
+func TestDaemonReload(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pipelines.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines:\n- name: pods\n  object-kind: Pod"), 0644))
+
+	base := plugin
+	defer func() {
+		plugin = base
+		flagConfig = Config{}
+		pipelines = nil
+	}()
+	plugin.AgentAPIURL = "http://127.0.0.1:3031/events"
+	plugin.Namespace = "all"
+	plugin.EventType = ""
+	plugin.ConfigFile = path
+	flagConfig = plugin
+
+	pipelines, err = loadPipelines(path)
+	require.NoError(t, err)
+	namespace, listOptions := sharedListOptions(pipelines)
+	d, err := newDaemon(fake.NewSimpleClientset(), namespace, listOptions, nil)
+	require.NoError(t, err)
+	assert.Equal("involvedObject.kind=Pod", d.listOptions.FieldSelector)
+
+	// Invalid configs are reported, and the current pipelines kept
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines:\n- name: pods\n  sink: nowhere"), 0644))
+	assert.False(d.reload())
+	require.Len(t, pipelines, 1)
+	assert.Equal("Pod", pipelines[0].config.ObjectKind)
+
+	// Selectors unchanged, the watch goes on
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines:\n- name: pods\n  object-kind: Pod\n  handlers: [slack]"), 0644))
+	assert.False(d.reload())
+	require.Len(t, pipelines, 1)
+	assert.Equal([]string{"slack"}, pipelines[0].config.Handlers)
+
+	// Selectors changed, the watch restarts from the last event seen
+	d.resourceVersions[""] = "10"
+	require.NoError(t, ioutil.WriteFile(path, []byte("pipelines:\n- name: pods\n  object-kind: Pod\n- name: nodes\n  object-kind: Node"), 0644))
+	assert.True(d.reload())
+	require.Len(t, pipelines, 2)
+	assert.Len(d.processors, 2)
+	assert.Equal("", d.listOptions.FieldSelector)
+	assert.Equal("10", d.resourceVersions[""])
+}
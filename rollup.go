@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// rollupThreshold sets the number of alerting events matching all of its
+// (non-empty) criteria from which the check itself is critical.
+type rollupThreshold struct {
+	// Kind is the kind of the involved object, case-insensitive
+	Kind string `json:"kind"`
+	// Reason is a regular expression matched against the event reason
+	Reason string `json:"reason"`
+	// Critical is the number of events making the check critical
+	Critical int `json:"critical"`
+
+	reason *regexp.Regexp
+}
+
+// rollupThresholds is the parsed --rollup-thresholds
+var rollupThresholds []rollupThreshold
+
+// parseRollupThresholds parses a JSON list of rollup thresholds.
+func parseRollupThresholds(text string) ([]rollupThreshold, error) {
+	thresholds := []rollupThreshold{}
+	if len(text) == 0 {
+		return thresholds, nil
+	}
+	if err := json.Unmarshal([]byte(text), &thresholds); err != nil {
+		return nil, fmt.Errorf("Failed to parse --rollup-thresholds: %v", err)
+	}
+	for i := range thresholds {
+		if thresholds[i].Critical <= 0 {
+			return nil, fmt.Errorf("Failed to parse rollup threshold %d: critical must be positive", i)
+		}
+		if len(thresholds[i].Reason) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(thresholds[i].Reason)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse reason of rollup threshold %d: %v", i, err)
+		}
+		thresholds[i].reason = re
+	}
+	return thresholds, nil
+}
+
+func (t rollupThreshold) matches(k8sEvent k8scorev1.Event) bool {
+	if len(t.Kind) > 0 && !strings.EqualFold(t.Kind, k8sEvent.InvolvedObject.Kind) {
+		return false
+	}
+	if t.reason != nil && !t.reason.MatchString(k8sEvent.Reason) {
+		return false
+	}
+	return true
+}
+
+// description describes the events matched by the threshold.
+func (t rollupThreshold) description() string {
+	criteria := []string{}
+	if len(t.Reason) > 0 {
+		criteria = append(criteria, fmt.Sprintf("reason %s", t.Reason))
+	}
+	if len(t.Kind) > 0 {
+		criteria = append(criteria, fmt.Sprintf("kind %s", t.Kind))
+	}
+	if len(criteria) == 0 {
+		return "all events"
+	}
+	return strings.Join(criteria, ", ")
+}
+
+// healthRollup rolls the events of a check run up into the status of the
+// check itself (see --rollup).
+type healthRollup struct {
+	thresholds []rollupThreshold
+	// counts are the alerting events matching each threshold
+	counts     []int
+	total      int
+	namespaces map[string]int
+	reasons    map[string]int
+}
+
+func newHealthRollup(thresholds []rollupThreshold) *healthRollup {
+	return &healthRollup{
+		thresholds: thresholds,
+		counts:     make([]int, len(thresholds)),
+		namespaces: make(map[string]int),
+		reasons:    make(map[string]int),
+	}
+}
+
+// add counts the event created for a Kubernetes event, if it is alerting.
+func (r *healthRollup) add(event *corev2.Event, k8sEvent k8scorev1.Event) {
+	if event.Check.Status == sensu.CheckStateOK {
+		return
+	}
+	_, namespace, _ := entityObject(k8sEvent)
+	if len(namespace) == 0 {
+		namespace = "cluster"
+	}
+	r.total++
+	r.namespaces[namespace]++
+	r.reasons[k8sEvent.Reason]++
+	for i, threshold := range r.thresholds {
+		if threshold.matches(k8sEvent) {
+			r.counts[i]++
+		}
+	}
+}
+
+// result returns the status of the check, warning if any alerting event was
+// sent and critical if a threshold was reached, and the output lines
+// describing it.
+func (r *healthRollup) result() (int, []string) {
+	status := sensu.CheckStateOK
+	if r.total > 0 {
+		status = sensu.CheckStateWarning
+	}
+
+	exceeded := []string{}
+	for i, threshold := range r.thresholds {
+		if r.counts[i] >= threshold.Critical {
+			status = sensu.CheckStateCritical
+			exceeded = append(exceeded, fmt.Sprintf("Critical: %d event(s) for %s, threshold %d", r.counts[i], threshold.description(), threshold.Critical))
+		}
+	}
+
+	lines := []string{fmt.Sprintf("%d alerting event(s)", r.total)}
+	if r.total > 0 {
+		lines = append(lines,
+			fmt.Sprintf("Top namespaces: %s", formatTopCounts(r.namespaces, plugin.RollupTop)),
+			fmt.Sprintf("Top reasons: %s", formatTopCounts(r.reasons, plugin.RollupTop)),
+		)
+	}
+	lines = append(lines, exceeded...)
+	return status, lines
+}
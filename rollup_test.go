@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func TestParseRollupThresholds(t *testing.T) {
+	thresholds, err := parseRollupThresholds("")
+	require.NoError(t, err)
+	assert.Empty(t, thresholds)
+
+	thresholds, err = parseRollupThresholds(`[{"kind": "Pod", "reason": "^(BackOff|Failed)$", "critical": 10}, {"critical": 50}]`)
+	require.NoError(t, err)
+	require.Len(t, thresholds, 2)
+	assert.Equal(t, "Pod", thresholds[0].Kind)
+	assert.Equal(t, 10, thresholds[0].Critical)
+	assert.NotNil(t, thresholds[0].reason)
+	assert.Nil(t, thresholds[1].reason)
+
+	_, err = parseRollupThresholds(`[{"reason": "("}]`)
+	assert.Error(t, err)
+	_, err = parseRollupThresholds(`[{"kind": "Pod"}]`)
+	assert.Error(t, err)
+	_, err = parseRollupThresholds(`{}`)
+	assert.Error(t, err)
+}
+
+func rollupEvent(kind, namespace, reason string, status uint32) (*corev2.Event, k8scorev1.Event) {
+	event := &corev2.Event{Check: &corev2.Check{Status: status}}
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = namespace
+	k8sev.InvolvedObject.Kind = kind
+	k8sev.InvolvedObject.Namespace = namespace
+	k8sev.Reason = reason
+	return event, k8sev
+}
+
+func TestHealthRollup(t *testing.T) {
+	plugin.RollupTop = 2
+	defer func() { plugin.RollupTop = 0 }()
+
+	thresholds, err := parseRollupThresholds(`[{"kind": "Pod", "reason": "BackOff", "critical": 3}, {"kind": "Node", "critical": 1}]`)
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name     string
+		events   [][]string
+		status   int
+		expected []string
+	}{
+		{
+			name:     "no events",
+			status:   0,
+			expected: []string{"0 alerting event(s)"},
+		},
+		{
+			name:   "ok events",
+			events: [][]string{{"Pod", "default", "Pulled", "0"}},
+			status: 0,
+			expected: []string{
+				"0 alerting event(s)",
+			},
+		},
+		{
+			name: "below thresholds",
+			events: [][]string{
+				{"Pod", "default", "BackOff", "1"},
+				{"Pod", "default", "BackOff", "2"},
+				{"Pod", "team-a", "Unhealthy", "1"},
+				{"Pod", "team-b", "Unhealthy", "1"},
+			},
+			status: 1,
+			expected: []string{
+				"4 alerting event(s)",
+				"Top namespaces: default (2), team-a (1)",
+				"Top reasons: BackOff (2), Unhealthy (2)",
+			},
+		},
+		{
+			name: "above thresholds",
+			events: [][]string{
+				{"Pod", "default", "BackOff", "1"},
+				{"Pod", "default", "BackOff", "1"},
+				{"Pod", "team-a", "BackOff", "1"},
+				{"Node", "", "NodeNotReady", "2"},
+			},
+			status: 2,
+			expected: []string{
+				"4 alerting event(s)",
+				"Top namespaces: default (2), cluster (1)",
+				"Top reasons: BackOff (3), NodeNotReady (1)",
+				"Critical: 3 event(s) for reason BackOff, kind Pod, threshold 3",
+				"Critical: 1 event(s) for kind Node, threshold 1",
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newHealthRollup(thresholds)
+			for _, ev := range tc.events {
+				status := map[string]uint32{"0": 0, "1": 1, "2": 2}[ev[3]]
+				r.add(rollupEvent(ev[0], ev[1], ev[2], status))
+			}
+			status, lines := r.result()
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.expected, lines)
+		})
+	}
+}
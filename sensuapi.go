@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+)
+
+// apiPageSize is the number of resources requested per page when listing
+// resources from the Sensu backend API.
+const apiPageSize = 500
+
+// sensuAPIClient is a minimal client for the Sensu backend API.
+type sensuAPIClient struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func newSensuAPIClient() (*sensuAPIClient, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if len(plugin.SensuTrustedCAFile) > 0 {
+		caCert, err := ioutil.ReadFile(plugin.SensuTrustedCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read trusted CA file %s: %v", plugin.SensuTrustedCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("No certificates found in trusted CA file %s", plugin.SensuTrustedCAFile)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+	return &sensuAPIClient{
+		url:    strings.TrimSuffix(plugin.SensuAPIURL, "/"),
+		apiKey: plugin.SensuAPIKey,
+		client: client,
+	}, nil
+}
+
+// sensuAPIStatusError is the error of a request the backend API answered with
+// an error status.
+type sensuAPIStatusError struct {
+	error
+	status int
+}
+
+// do sends a request to the Sensu backend API. The body, if not nil, is sent
+// as JSON, and the response is decoded into out if it is not nil.
+func (c *sensuAPIClient) do(method, path string, body, out interface{}) error {
+	_, err := c.request(method, path, body, out)
+	return err
+}
+
+// request is like do but also returns the response headers.
+func (c *sensuAPIClient) request(method, path string, body, out interface{}) (http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode request body for %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewBuffer(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(apiContext, method, c.url+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request %s %s: %v", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.apiKey) > 0 {
+		req.Header.Set("Authorization", fmt.Sprintf("Key %s", c.apiKey))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		telemetry.apiError("sensu")
+		return nil, fmt.Errorf("Failed to %s %s%s: %v", method, c.url, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		telemetry.apiError("sensu")
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("%s %s%s failed with status %v: %s", method, c.url, path, resp.Status, strings.TrimSpace(string(msg)))
+		return nil, sensuAPIStatusError{error: err, status: resp.StatusCode}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("Failed to decode response of %s %s%s: %v", method, c.url, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// listEntities returns all entities in a Sensu namespace, following the
+// pagination of the backend API.
+func (c *sensuAPIClient) listEntities(namespace string) ([]*corev2.Entity, error) {
+	entities := []*corev2.Entity{}
+	continueToken := ""
+	for {
+		path := fmt.Sprintf("/api/core/v2/namespaces/%s/entities?limit=%d", url.PathEscape(namespace), apiPageSize)
+		if len(continueToken) > 0 {
+			path += "&continue=" + url.QueryEscape(continueToken)
+		}
+		page := []*corev2.Entity{}
+		header, err := c.request("GET", path, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, page...)
+		continueToken = header.Get("Sensu-Continue")
+		if len(continueToken) == 0 {
+			return entities, nil
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// shardGroupLabel labels the membership Leases of the replicas sharing
+// namespaces, with the --shard-lease-prefix as value.
+const shardGroupLabel = "sensu.io/shard-group"
+
+// shardVirtualNodes is the number of points of each replica on the hash ring,
+// to spread namespaces evenly.
+const shardVirtualNodes = 100
+
+// hashRing assigns keys to members by consistent hashing, so that only the
+// keys of a member that comes or goes move.
+type hashRing struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+// hashKey hashes a key onto the ring. FNV is avoided as it spreads keys that
+// only differ by their last characters (e.g. replica names) poorly.
+func hashKey(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+func newHashRing(members []string) *hashRing {
+	r := &hashRing{owners: make(map[uint32]string)}
+	for _, member := range members {
+		for i := 0; i < shardVirtualNodes; i++ {
+			point := hashKey(fmt.Sprintf("%s#%d", member, i))
+			r.points = append(r.points, point)
+			r.owners[point] = member
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the member owning a key, the first one clockwise on the ring.
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// shardMembership maintains the membership Lease of this replica and the hash
+// ring of the live members, to shard namespaces across replicas (see --shard).
+// Each replica only watches the events of the namespaces it owns.
+type shardMembership struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+	duration  time.Duration
+	// prefix is the --shard-lease-prefix, as the membership is renewed
+	// concurrently with the processing of events, which activates the
+	// settings of each pipeline
+	prefix string
+
+	mu      sync.Mutex
+	members []string
+	ring    *hashRing
+	// renewed is when the Lease of this replica was last renewed
+	renewed time.Time
+	// changes is notified when the members change, for the namespaces owned
+	// to be watched again
+	changes chan struct{}
+}
+
+func newShardMembership(client kubernetes.Interface) (*shardMembership, error) {
+	identity, err := leaderElectionIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return &shardMembership{
+		client:    client,
+		namespace: leaderElectionNamespace(),
+		identity:  identity,
+		duration:  leaderElectLeaseDuration,
+		prefix:    plugin.ShardLeasePrefix,
+		ring:      newHashRing(nil),
+		changes:   make(chan struct{}, 1),
+	}, nil
+}
+
+// leaseName returns the name of the membership Lease of this replica.
+func (m *shardMembership) leaseName() string {
+	return strings.ToLower(fmt.Sprintf("%s-%s", m.prefix, m.identity))
+}
+
+// renew renews the Lease of this replica, creating it if needed, and updates
+// the members from the Leases that haven't expired.
+func (m *shardMembership) renew(now time.Time) error {
+	leases := m.client.CoordinationV1().Leases(m.namespace)
+	renewTime := metav1.NewMicroTime(now)
+	durationSeconds := int32(m.duration.Seconds())
+
+	lease, err := leases.Get(apiContext, m.leaseName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.leaseName(),
+				Namespace: m.namespace,
+				Labels:    map[string]string{shardGroupLabel: m.prefix},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &m.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+		_, err = leases.Create(apiContext, lease, metav1.CreateOptions{})
+	} else if err == nil {
+		lease.Spec.HolderIdentity = &m.identity
+		lease.Spec.LeaseDurationSeconds = &durationSeconds
+		lease.Spec.RenewTime = &renewTime
+		_, err = leases.Update(apiContext, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		telemetry.apiError("kubernetes")
+		return fmt.Errorf("Failed to renew shard Lease %s/%s: %v", m.namespace, m.leaseName(), err)
+	}
+
+	list, err := leases.List(apiContext, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", shardGroupLabel, m.prefix),
+	})
+	if err != nil {
+		telemetry.apiError("kubernetes")
+		return fmt.Errorf("Failed to list shard Leases: %v", err)
+	}
+	members := []string{m.identity}
+	for _, lease := range list.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || *spec.HolderIdentity == m.identity || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if expiry.After(now) {
+			members = append(members, *spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewed = now
+	if strings.Join(members, ",") != strings.Join(m.members, ",") {
+		logger.Infof("Shard members: %s", strings.Join(members, ", "))
+		m.members = members
+		m.ring = newHashRing(members)
+		telemetry.setShardMembers(len(members))
+		select {
+		case m.changes <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// owns reports whether this replica owns a Kubernetes namespace. It owns none
+// once its own Lease expired, as other replicas will have taken them over.
+func (m *shardMembership) owns(namespace string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.After(m.renewed.Add(m.duration)) {
+		return false
+	}
+	return m.ring.owner(namespace) == m.identity
+}
+
+// run renews the membership until stopped, then releases the Lease for the
+// other replicas to take over right away.
+func (m *shardMembership) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.renew(time.Now()); err != nil {
+				logger.Error(err)
+			}
+		case <-stop:
+			err := m.client.CoordinationV1().Leases(m.namespace).Delete(apiContext, m.leaseName(), metav1.DeleteOptions{})
+			if err != nil && !k8serrors.IsNotFound(err) {
+				logger.Errorf("Failed to release shard Lease %s/%s: %v", m.namespace, m.leaseName(), err)
+			}
+			return
+		}
+	}
+}
+
+// eventNamespace returns the namespace a Kubernetes event is sharded by.
+func eventNamespace(k8sEvent k8scorev1.Event) string {
+	if len(k8sEvent.InvolvedObject.Namespace) > 0 {
+		return k8sEvent.InvolvedObject.Namespace
+	}
+	return k8sEvent.ObjectMeta.Namespace
+}
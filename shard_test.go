@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHashRing(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", newHashRing(nil).owner("default"))
+
+	three := newHashRing([]string{"replica-1", "replica-2", "replica-3"})
+	two := newHashRing([]string{"replica-1", "replica-3"})
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		namespace := fmt.Sprintf("team-%d", i)
+		owner := three.owner(namespace)
+		counts[owner]++
+		if owner != "replica-2" {
+			// Only the namespaces of the replica that left move
+			assert.Equal(owner, two.owner(namespace), namespace)
+		}
+	}
+	for _, count := range counts {
+		assert.InDelta(100, count, 40)
+	}
+}
+
+func TestShardMembership(t *testing.T) {
+	plugin.ShardLeasePrefix = "sensu-kubernetes-events-shard"
+	plugin.LeaderElectNamespace = "monitoring"
+	leaderElectLeaseDuration = 15 * time.Second
+	defer func() {
+		plugin.ShardLeasePrefix = ""
+		plugin.LeaderElectNamespace = ""
+		plugin.LeaderElectIdentity = ""
+		leaderElectLeaseDuration = 0
+	}()
+
+	clientset := fake.NewSimpleClientset()
+	memberships := []*shardMembership{}
+	for _, identity := range []string{"replica-1", "replica-2"} {
+		plugin.LeaderElectIdentity = identity
+		m, err := newShardMembership(clientset)
+		require.NoError(t, err)
+		memberships = append(memberships, m)
+	}
+	// Pipelines activated while the membership is renewed don't change it
+	plugin.ShardLeasePrefix = "other"
+	assert.Equal(t, "sensu-kubernetes-events-shard-replica-1", memberships[0].leaseName())
+
+	now := time.Now()
+	for _, m := range memberships {
+		require.NoError(t, m.renew(now))
+	}
+	// The first replica only sees the second one once renewed again
+	require.NoError(t, memberships[0].renew(now))
+	for _, m := range memberships {
+		assert.Equal(t, []string{"replica-1", "replica-2"}, m.members)
+	}
+
+	for i := 0; i < 20; i++ {
+		namespace := fmt.Sprintf("team-%d", i)
+		assert.NotEqual(t, memberships[0].owns(namespace, now), memberships[1].owns(namespace, now), namespace)
+	}
+
+	// Once the second replica's Lease expires, the first one takes over
+	later := now.Add(20 * time.Second)
+	require.NoError(t, memberships[0].renew(later))
+	assert.Equal(t, []string{"replica-1"}, memberships[0].members)
+	assert.True(t, memberships[0].owns("team-1", later))
+	assert.False(t, memberships[1].owns("team-1", later))
+}
+
+func TestEventNamespace(t *testing.T) {
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Namespace = "default"
+	assert.Equal(t, "default", eventNamespace(k8sev))
+	k8sev.InvolvedObject.Namespace = "team-a"
+	assert.Equal(t, "team-a", eventNamespace(k8sev))
+}
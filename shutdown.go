@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownGracePeriod is the parsed --shutdown-grace-period
+var shutdownGracePeriod time.Duration
+
+var (
+	// intakeContext is canceled on SIGTERM or SIGINT, to stop taking in
+	// Kubernetes events
+	intakeContext, stopIntake = context.WithCancel(context.Background())
+	// apiContext is the context of the Kubernetes and Sensu API requests. It
+	// outlives intakeContext by --shutdown-grace-period, for the events
+	// already taken in to be delivered.
+	apiContext, cancelAPI = context.WithCancel(context.Background())
+)
+
+// handleShutdown handles SIGTERM and SIGINT: the first one stops the intake of
+// events, and API requests are canceled once the grace period is over, or on
+// the second one.
+func handleShutdown() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.Infof("Received %v, stopping within %v", sig, shutdownGracePeriod)
+		stopIntake()
+		select {
+		case <-time.After(shutdownGracePeriod):
+			logger.Warnf("Shutdown grace period of %v is over, canceling API requests", shutdownGracePeriod)
+		case sig = <-signals:
+			logger.Warnf("Received %v again, canceling API requests", sig)
+		}
+		cancelAPI()
+	}()
+}
+
+// shuttingDown reports whether the intake of events stopped.
+func shuttingDown() bool {
+	return intakeContext.Err() != nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// downgradeStatus returns the status an event is downgraded to when it is
+// expected (e.g. during maintenance): critical becomes warning, anything else
+// becomes OK.
+func downgradeStatus(status uint32) uint32 {
+	if status == sensu.CheckStateCritical {
+		return sensu.CheckStateWarning
+	}
+	return sensu.CheckStateOK
+}
+
+// silencedUntil returns the expiry of the --silence-annotation on the object
+// involved in a Kubernetes event, or on its namespace, whichever is later. It
+// also returns a description of where the annotation was found. The returned
+// time is zero if neither is annotated, or if the annotation has expired.
+func silencedUntil(k8sEvent k8scorev1.Event, cache *objectCache, now time.Time) (time.Time, string, error) {
+	var (
+		until  time.Time
+		source string
+	)
+
+	refs := []k8scorev1.ObjectReference{k8sEvent.InvolvedObject}
+	_, namespace, _ := entityObject(k8sEvent)
+	if len(namespace) > 0 {
+		refs = append(refs, k8scorev1.ObjectReference{Kind: "Namespace", Name: namespace})
+	}
+
+	for _, ref := range refs {
+		meta, err := cache.getObjectMeta(ref, k8sEvent.ObjectMeta.Namespace)
+		if err == errUnsupportedKind {
+			continue
+		} else if err != nil {
+			return time.Time{}, "", err
+		}
+		if meta == nil {
+			continue
+		}
+		value, ok := meta.Annotations[plugin.SilenceAnnotation]
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			// Not a valid expiry, don't let a typo silence alerts
+			continue
+		}
+		if t.After(now) && t.After(until) {
+			until = t
+			source = fmt.Sprintf("%s %s", ref.Kind, meta.Name)
+		}
+	}
+
+	return until, source, nil
+}
+
+// silencer applies the --silence-action to events whose involved object (or
+// its namespace) carries the --silence-annotation.
+type silencer struct {
+	cache    *objectCache
+	client   *sensuAPIClient
+	silenced map[string]bool
+}
+
+func newSilencer(cache *objectCache, client *sensuAPIClient) *silencer {
+	return &silencer{
+		cache:    cache,
+		client:   client,
+		silenced: make(map[string]bool),
+	}
+}
+
+// apply applies the silence action to the event created for a Kubernetes
+// event, and reports whether the event should be skipped.
+func (s *silencer) apply(event *corev2.Event, k8sEvent k8scorev1.Event, now time.Time) (bool, error) {
+	until, source, err := silencedUntil(k8sEvent, s.cache, now)
+	if err != nil {
+		return false, err
+	}
+	if until.IsZero() {
+		return false, nil
+	}
+
+	switch plugin.SilenceAction {
+	case "skip":
+		return true, nil
+	case "downgrade":
+		event.Check.Status = downgradeStatus(event.Check.Status)
+	case "silence":
+		namespace := event.ObjectMeta.Namespace
+		if len(namespace) == 0 {
+			namespace = plugin.SensuNamespace
+		}
+		silenced := &corev2.Silenced{
+			ObjectMeta:   corev2.ObjectMeta{Namespace: namespace},
+			Subscription: fmt.Sprintf("entity:%s", event.Check.ProxyEntityName),
+			Check:        event.Check.ObjectMeta.Name,
+			Expire:       int64(until.Sub(now).Seconds()),
+			Creator:      plugin.PluginConfig.Name,
+			Reason:       fmt.Sprintf("%s on %s until %s", plugin.SilenceAnnotation, source, until.Format(time.RFC3339)),
+		}
+		uri := silenced.URIPath()
+		if s.silenced[uri] {
+			return false, nil
+		}
+		if err := s.client.do("PUT", uri, silenced, nil); err != nil {
+			return false, fmt.Errorf("Failed to silence %s: %v", silenced.Name, err)
+		}
+		s.silenced[uri] = true
+	}
+	return false, nil
+}
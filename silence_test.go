@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDowngradeStatus(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint32(1), downgradeStatus(2))
+	assert.Equal(uint32(0), downgradeStatus(1))
+	assert.Equal(uint32(0), downgradeStatus(0))
+	assert.Equal(uint32(0), downgradeStatus(3))
+}
+
+func silenceFixtures(now time.Time) *objectCache {
+	annotation := func(t time.Time) map[string]string {
+		return map[string]string{"sensu.io/silence-until": t.Format(time.RFC3339)}
+	}
+	return newObjectCache(fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: "maintained", Namespace: "default", Annotations: annotation(now.Add(time.Hour)),
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: "expired", Namespace: "default", Annotations: annotation(now.Add(-time.Hour)),
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: "typo", Namespace: "default", Annotations: map[string]string{"sensu.io/silence-until": "tomorrow"},
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "maintenance"}},
+		&k8scorev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&k8scorev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "maintenance", Annotations: annotation(now.Add(2 * time.Hour)),
+		}},
+	))
+}
+
+func TestSilencedUntil(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := silenceFixtures(now)
+	plugin.SilenceAnnotation = "sensu.io/silence-until"
+
+	testcases := []struct {
+		namespace string
+		name      string
+		until     time.Time
+		source    string
+	}{
+		{"default", "maintained", now.Add(time.Hour), "Deployment maintained"},
+		{"default", "expired", time.Time{}, ""},
+		{"default", "typo", time.Time{}, ""},
+		{"default", "nginx", time.Time{}, ""},
+		{"default", "deleted", time.Time{}, ""},
+		{"maintenance", "nginx", now.Add(2 * time.Hour), "Namespace maintenance"},
+	}
+	for _, tc := range testcases {
+		k8sev := k8scorev1.Event{}
+		k8sev.ObjectMeta.Namespace = tc.namespace
+		k8sev.InvolvedObject.Kind = "Deployment"
+		k8sev.InvolvedObject.Name = tc.name
+		until, source, err := silencedUntil(k8sev, cache, now)
+		assert.NoError(t, err)
+		assert.True(t, tc.until.Equal(until), "%s/%s: %v", tc.namespace, tc.name, until)
+		assert.Equal(t, tc.source, source)
+	}
+}
+
+func TestSilencerApply(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	requests := 0
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "PUT", r.Method)
+		assert.Equal(t, "/api/core/v2/namespaces/default/silenced/entity:maintained:maintained-unhealthy", r.URL.Path)
+		silenced := &corev2.Silenced{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(silenced))
+		assert.Equal(t, int64(3600), silenced.Expire)
+		assert.Equal(t, "entity:maintained", silenced.Subscription)
+		assert.Equal(t, "maintained-unhealthy", silenced.Check)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer test.Close()
+
+	plugin.SensuAPIURL = test.URL
+	plugin.SensuNamespace = "default"
+	plugin.SilenceAnnotation = "sensu.io/silence-until"
+	defer func() {
+		plugin.SensuAPIURL = ""
+		plugin.SilenceAction = ""
+	}()
+	client, err := newSensuAPIClient()
+	require.NoError(t, err)
+
+	testcases := []struct {
+		action string
+		name   string
+		skip   bool
+		status uint32
+	}{
+		{"skip", "maintained", true, 2},
+		{"skip", "nginx", false, 2},
+		{"downgrade", "maintained", false, 1},
+		{"downgrade", "nginx", false, 2},
+		{"silence", "maintained", false, 2},
+		{"silence", "maintained", false, 2},
+	}
+	s := newSilencer(silenceFixtures(now), client)
+	for _, tc := range testcases {
+		assert := assert.New(t)
+		plugin.SilenceAction = tc.action
+		k8sev := k8scorev1.Event{}
+		k8sev.ObjectMeta.Namespace = "default"
+		k8sev.InvolvedObject.Kind = "Deployment"
+		k8sev.InvolvedObject.Name = tc.name
+		event := &corev2.Event{Check: &corev2.Check{Status: 2, ProxyEntityName: tc.name}}
+		event.Check.ObjectMeta.Name = tc.name + "-unhealthy"
+		skip, err := s.apply(event, k8sev, now)
+		assert.NoError(err)
+		assert.Equal(tc.skip, skip)
+		assert.Equal(tc.status, event.Check.Status)
+	}
+	// Silenced entries are only created once per run
+	assert.Equal(t, 1, requests)
+}
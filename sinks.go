@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// eventSink delivers the Sensu events created by the check.
+type eventSink interface {
+	submit(event *corev2.Event) error
+}
+
+// agentSink posts events to the Sensu agent API, which assigns them to the
+// namespace of the agent.
+type agentSink struct{}
+
+func (agentSink) submit(event *corev2.Event) error {
+	return submitEventAgentAPI(event)
+}
+
+// backendSink puts events through the Sensu backend API, into the Sensu
+// namespace of each event.
+type backendSink struct {
+	client *sensuAPIClient
+}
+
+func (s backendSink) submit(event *corev2.Event) error {
+	namespace := event.ObjectMeta.Namespace
+	if len(namespace) == 0 {
+		namespace = plugin.SensuNamespace
+	}
+
+	// Unlike the agent, the backend API doesn't process proxy_entity_name so
+	// the event needs to reference its (proxy) entity.
+	backendEvent := *event
+	check := *event.Check
+	backendEvent.Check = &check
+	backendEvent.Check.ObjectMeta.Namespace = namespace
+	backendEvent.ObjectMeta.Namespace = namespace
+	entity := corev2.NewEntity(corev2.ObjectMeta{
+		Name:      event.Check.ProxyEntityName,
+		Namespace: namespace,
+	})
+	entity.EntityClass = corev2.EntityProxyClass
+	if len(event.Check.ProxyEntityName) == 0 {
+		// Events about the cluster as a whole belong to the check's own entity
+		entity.Name = plugin.EntityName
+		entity.EntityClass = corev2.EntityAgentClass
+	}
+	backendEvent.Entity = entity
+
+	if err := s.client.do("PUT", backendEvent.URIPath(), &backendEvent, nil); err != nil {
+		return fmt.Errorf("Failed to put event %s/%s: %v", entity.Name, check.Name, err)
+	}
+	return nil
+}
+
+// instrumentedSink records the deliveries of a sink in the telemetry.
+type instrumentedSink struct {
+	sink eventSink
+}
+
+func (s instrumentedSink) submit(event *corev2.Event) error {
+	start := time.Now()
+	err := s.sink.submit(event)
+	telemetry.eventDelivered(time.Since(start), err)
+	entry := pipelineLog().WithFields(logrus.Fields{
+		"namespace": event.ObjectMeta.Namespace,
+		"entity":    event.Check.ProxyEntityName,
+		"check":     event.Check.ObjectMeta.Name,
+		"duration":  time.Since(start),
+	})
+	if err != nil {
+		entry.WithError(err).Debug("Event delivery failed")
+	} else {
+		entry.Debug("Event delivered")
+	}
+	return err
+}
+
+// newEventSink returns the sink selected by --sink.
+func newEventSink(client *sensuAPIClient) eventSink {
+	if plugin.Sink == "backend" {
+		return backendSink{client: client}
+	}
+	if plugin.Sink == "collector" {
+		return collectorSink{}
+	}
+	return agentSink{}
+}
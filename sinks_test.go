@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendSink(t *testing.T) {
+	assert := assert.New(t)
+	var test = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("PUT", r.Method)
+		assert.Equal("/api/core/v2/namespaces/team-payments/events/nginx-1/pod-failed", r.URL.Path)
+		event := &corev2.Event{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(event))
+		assert.Equal("proxy", event.Entity.EntityClass)
+		assert.Equal("team-payments", event.Entity.Namespace)
+		assert.Equal("team-payments", event.Check.Namespace)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer test.Close()
+
+	plugin.SensuAPIURL = test.URL
+	plugin.Sink = "backend"
+	defer func() {
+		plugin.SensuAPIURL = ""
+		plugin.Sink = ""
+	}()
+	client, err := newSensuAPIClient()
+	require.NoError(t, err)
+	sink := newEventSink(client)
+
+	event := &corev2.Event{Check: &corev2.Check{ProxyEntityName: "nginx-1"}}
+	event.Check.ObjectMeta.Name = "pod-failed"
+	event.ObjectMeta.Namespace = "team-payments"
+	assert.NoError(sink.submit(event))
+	// The event itself is left untouched
+	assert.Nil(event.Entity)
+}
+
+func TestAgentSink(t *testing.T) {
+	plugin.Sink = "agent"
+	defer func() { plugin.Sink = "" }()
+	_, ok := newEventSink(nil).(agentSink)
+	assert.True(t, ok)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+)
+
+// rejectedEventError is the delivery error of an event the API rejected. It is
+// not spooled, as delivering it again would fail again.
+type rejectedEventError struct {
+	error
+}
+
+// spoolDir returns the spool directory of the current pipeline: the
+// --spool-dir, or a subdirectory of it for each pipeline of --config, as
+// pipelines deliver events to their own sinks.
+func spoolDir() string {
+	if len(plugin.Pipeline) == 0 {
+		return plugin.SpoolDir
+	}
+	return filepath.Join(plugin.SpoolDir, "pipeline-"+url.PathEscape(plugin.Pipeline))
+}
+
+// eventSpool persists the Sensu events that could not be delivered in a
+// directory, one file per event, named to be replayed first in, first out.
+type eventSpool struct {
+	dir string
+	// max bounds the number of events, the oldest being dropped
+	max int
+}
+
+// files returns the files of the spooled events, oldest first.
+func (s eventSpool) files() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read spool %s: %v", s.dir, err)
+	}
+	files := []string{}
+	for _, info := range infos {
+		// Files still being written end with .tmp
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+			files = append(files, filepath.Join(s.dir, info.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// push spools an event, dropping the oldest events beyond the bound. It
+// returns the number of events dropped.
+func (s eventSpool) push(event *corev2.Event) (int, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to encode event for the spool: %v", err)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return 0, fmt.Errorf("Failed to create spool %s: %v", s.dir, err)
+	}
+	// Write then rename, so that replays never read a partial event
+	tmp, err := ioutil.TempFile(s.dir, fmt.Sprintf("%020d-*.json.tmp", time.Now().UnixNano()))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to spool event: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("Failed to spool event: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("Failed to spool event: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), strings.TrimSuffix(tmp.Name(), ".tmp")); err != nil {
+		return 0, fmt.Errorf("Failed to spool event: %v", err)
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for ; len(files)-dropped > s.max; dropped++ {
+		if err := os.Remove(files[dropped]); err != nil {
+			return dropped, fmt.Errorf("Failed to drop spooled event %s: %v", files[dropped], err)
+		}
+	}
+	return dropped, nil
+}
+
+// replay delivers the spooled events in order, until one fails. It returns
+// the number of events delivered, and of unreadable or rejected events
+// dropped.
+func (s eventSpool) replay(sink eventSink) (int, int, error) {
+	files, err := s.files()
+	if err != nil {
+		return 0, 0, err
+	}
+	replayed, dropped := 0, 0
+	for _, file := range files {
+		event := &corev2.Event{}
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, event)
+		}
+		if err != nil {
+			logger.Warnf("Dropping unreadable spooled event %s: %v", file, err)
+			dropped++
+			os.Remove(file)
+			continue
+		}
+		err = sink.submit(event)
+		if _, ok := err.(rejectedEventError); ok {
+			logger.Warnf("Dropping spooled event %s: %v", file, err)
+			dropped++
+		} else if err != nil {
+			return replayed, dropped, err
+		} else {
+			replayed++
+		}
+		if err := os.Remove(file); err != nil {
+			return replayed, dropped, fmt.Errorf("Failed to remove spooled event %s: %v", file, err)
+		}
+	}
+	return replayed, dropped, nil
+}
+
+// spoolingSink delivers events through a sink, spooling those it fails to
+// deliver (see --spool-dir). Spooled events are replayed before new ones are
+// delivered, and at the end of each run.
+type spoolingSink struct {
+	sink  eventSink
+	spool eventSpool
+
+	// down is set once a delivery failed, to spool the next events of the run
+	// without trying them
+	down bool
+	// drained is set once the spool was emptied
+	drained bool
+
+	spooled  int
+	replayed int
+	dropped  int
+}
+
+func newSpoolingSink(sink eventSink, spool eventSpool) *spoolingSink {
+	return &spoolingSink{sink: sink, spool: spool}
+}
+
+func (s *spoolingSink) submit(event *corev2.Event) error {
+	if !s.down && s.drain() == nil {
+		return s.delivered(s.sink.submit(event), event)
+	}
+	return s.push(event)
+}
+
+// delivered handles the result of a delivery, spooling the events that
+// failed to be delivered: the event submitted, or the batch that failed.
+func (s *spoolingSink) delivered(err error, event *corev2.Event) error {
+	if _, ok := err.(rejectedEventError); ok || err == nil {
+		return err
+	}
+	logger.Warnf("Spooling events, failed to deliver: %v", err)
+	s.down = true
+	if batch, ok := err.(batchError); ok {
+		return s.push(batch.events...)
+	}
+	return s.push(event)
+}
+
+// push spools events.
+func (s *spoolingSink) push(events ...*corev2.Event) error {
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		dropped, err := s.spool.push(event)
+		s.dropped += dropped
+		if err != nil {
+			telemetry.eventsSpooled(0, dropped)
+			return err
+		}
+		s.spooled++
+		telemetry.eventsSpooled(1, dropped)
+	}
+	return nil
+}
+
+// flushBatch delivers the events queued by the sink for batching, if any.
+func (s *spoolingSink) flushBatch() error {
+	if f, ok := s.sink.(batchFlusher); ok {
+		return s.delivered(f.flushBatch(), nil)
+	}
+	return nil
+}
+
+// drain replays the spooled events, unless it already emptied the spool.
+func (s *spoolingSink) drain() error {
+	if s.drained {
+		return nil
+	}
+	replayed, dropped, err := s.spool.replay(s.direct())
+	s.replayed += replayed
+	s.dropped += dropped
+	telemetry.eventsReplayed(replayed, dropped)
+	if err != nil {
+		logger.Warnf("Failed to replay spooled events: %v", err)
+		s.down = true
+		return err
+	}
+	s.drained = true
+	return nil
+}
+
+// direct returns the sink delivering events right away, bypassing batching,
+// for replayed events to only be removed from the spool once delivered.
+func (s *spoolingSink) direct() eventSink {
+	if batching, ok := s.sink.(*batchingSink); ok {
+		return instrumentedSink{sink: batching.sink}
+	}
+	return s.sink
+}
+
+// depth returns the number of events in the spool.
+func (s *spoolingSink) depth() int {
+	files, err := s.spool.files()
+	if err != nil {
+		logger.Warn(err)
+	}
+	return len(files)
+}
+
+// flush replays the spooled events at the end of a run, and returns a summary
+// of the spool if it was used.
+func (s *spoolingSink) flush() []string {
+	if !s.down {
+		s.drain()
+	}
+	depth := s.depth()
+	telemetry.setSpoolDepth(s.spool.dir, depth)
+	if s.spooled == 0 && s.replayed == 0 && s.dropped == 0 && depth == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("Spool: %d event(s) spooled, %d replayed, %d dropped, %d in %s", s.spooled, s.replayed, s.dropped, depth, s.spool.dir)}
+}
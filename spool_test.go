@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// flakySink delivers events unless down, recording the names of their checks.
+type flakySink struct {
+	down      bool
+	delivered []string
+}
+
+func (s *flakySink) submit(event *corev2.Event) error {
+	if s.down {
+		return errors.New("connection refused")
+	}
+	if event.Check.Name == "rejected" {
+		return rejectedEventError{errors.New("bad request")}
+	}
+	s.delivered = append(s.delivered, event.Check.Name)
+	return nil
+}
+
+func spoolEvent(check string) *corev2.Event {
+	return corev2.FixtureEvent("nginx", check)
+}
+
+func TestEventSpool(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	spool := eventSpool{dir: dir, max: 2}
+	for i, check := range []string{"a", "b", "c"} {
+		dropped, err := spool.push(spoolEvent(check))
+		require.NoError(t, err)
+		assert.Equal(i/2, dropped)
+	}
+
+	sink := &flakySink{}
+	replayed, dropped, err := spool.replay(sink)
+	require.NoError(t, err)
+	assert.Equal(2, replayed)
+	assert.Equal(0, dropped)
+	assert.Equal([]string{"b", "c"}, sink.delivered)
+	files, err := spool.files()
+	require.NoError(t, err)
+	assert.Empty(files)
+}
+
+func TestSpoolingSink(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	spool := eventSpool{dir: dir, max: 10}
+
+	// The agent is down, events are spooled
+	sink := &flakySink{down: true}
+	s := newSpoolingSink(sink, spool)
+	require.NoError(t, s.submit(spoolEvent("a")))
+	require.NoError(t, s.submit(spoolEvent("b")))
+	assert.Equal([]string{"Spool: 2 event(s) spooled, 0 replayed, 0 dropped, 2 in " + dir}, s.flush())
+
+	// Back up on the next run, spooled events are delivered first
+	sink.down = false
+	s = newSpoolingSink(sink, spool)
+	require.NoError(t, s.submit(spoolEvent("c")))
+	assert.Error(s.submit(spoolEvent("rejected")))
+	assert.Equal([]string{"a", "b", "c"}, sink.delivered)
+	assert.Equal([]string{"Spool: 0 event(s) spooled, 2 replayed, 0 dropped, 0 in " + dir}, s.flush())
+	assert.Equal(0, s.depth())
+
+	// Nothing to report once the spool is empty
+	s = newSpoolingSink(sink, spool)
+	assert.Empty(s.flush())
+}
+
+func TestPipelineSpools(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	collected := []string{}
+	var collector = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events := []*corev2.Event{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+		for _, event := range events {
+			collected = append(collected, event.Check.Name)
+		}
+	}))
+	defer collector.Close()
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	agent.Close()
+
+	base := plugin
+	defer func() { plugin = base }()
+	plugin.StatusMap = `{"normal": 0, "warning": 1, "default": 3}`
+	plugin.SpoolDir = dir
+	plugin.SpoolMaxEvents = 10
+	k8sev := k8scorev1.Event{}
+	k8sev.Namespace = "default"
+	k8sev.Type = "Warning"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+
+	// The agent of the first pipeline is down, its event is spooled
+	plugin.Pipeline = "agent"
+	plugin.AgentAPIURL = agent.URL
+	agentProcessor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	k8sev.Reason = "BackOff"
+	_, err = agentProcessor.handle(k8sev)
+	require.NoError(t, err)
+	assert.Equal(1, agentProcessor.spool.depth())
+	assert.Equal(filepath.Join(dir, "pipeline-agent"), agentProcessor.spool.spool.dir)
+
+	// The second pipeline only replays its own spool to its collector
+	plugin.Pipeline = "collector"
+	plugin.Sink = "collector"
+	plugin.CollectorURL = collector.URL
+	collectorProcessor, err := newEventProcessor(fake.NewSimpleClientset())
+	require.NoError(t, err)
+	k8sev.Reason = "Failed"
+	_, err = collectorProcessor.handle(k8sev)
+	require.NoError(t, err)
+	output, err := collectorProcessor.flush()
+	require.NoError(t, err)
+	assert.Empty(output)
+	assert.Equal([]string{"pod-failed"}, collected)
+	assert.Equal(1, agentProcessor.spool.depth())
+}
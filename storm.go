@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// suppressedCheckName is the check name of the events aggregating the events
+// suppressed by the per-entity limit and the global limit.
+const suppressedCheckName = "kubernetes-events-suppressed"
+
+// suppressedEvents aggregates the events suppressed for a given limit.
+type suppressedEvents struct {
+	// event is the first suppressed event, used as a template for the
+	// aggregated event
+	event *corev2.Event
+	// object is the object of the entity of the first suppressed event
+	object  k8scorev1.ObjectReference
+	count   int
+	status  uint32
+	reasons map[string]int
+	// namespaces are the Kubernetes namespaces of the events
+	namespaces map[string]bool
+	// description describes what the events were suppressed for
+	description string
+}
+
+// namespace returns the namespace of the entity of the aggregated event of
+// events spanning entities: their namespace, or none (the cluster) if they
+// span namespaces (or are about cluster scoped objects), like with
+// --aggregate namespace.
+func (s *suppressedEvents) namespace() string {
+	if len(s.namespaces) == 1 {
+		for namespace := range s.namespaces {
+			return namespace
+		}
+	}
+	return ""
+}
+
+// stormLimiter limits the number of events sent per entity, per check and per
+// run, aggregating the events that exceed the limits.
+type stormLimiter struct {
+	perEntity map[string]int
+	perCheck  map[string]int
+	total     int
+
+	suppressed map[string]*suppressedEvents
+	// order is the order in which limits were first exceeded
+	order []string
+}
+
+func newStormLimiter() *stormLimiter {
+	return &stormLimiter{
+		perEntity:  make(map[string]int),
+		perCheck:   make(map[string]int),
+		suppressed: make(map[string]*suppressedEvents),
+	}
+}
+
+// allow reports whether an event is within the limits. Events that are not
+// are recorded to be aggregated.
+func (l *stormLimiter) allow(event *corev2.Event, k8sEvent k8scorev1.Event) bool {
+	entityKey := fmt.Sprintf("%s/%s", event.ObjectMeta.Namespace, event.Check.ProxyEntityName)
+	checkKey := fmt.Sprintf("%s/%s", event.ObjectMeta.Namespace, event.Check.ObjectMeta.Name)
+
+	switch {
+	case plugin.MaxEventsPerEntity > 0 && l.perEntity[entityKey] >= plugin.MaxEventsPerEntity:
+		l.suppress("entity:"+entityKey, event, k8sEvent, fmt.Sprintf("%s %s", strings.ToLower(k8sEvent.InvolvedObject.Kind), event.Check.ProxyEntityName))
+	case plugin.MaxEventsPerCheck > 0 && l.perCheck[checkKey] >= plugin.MaxEventsPerCheck:
+		l.suppress("check:"+checkKey, event, k8sEvent, fmt.Sprintf("check %s", event.Check.ObjectMeta.Name))
+	case plugin.MaxEventsPerRun > 0 && l.total >= plugin.MaxEventsPerRun:
+		l.suppress("run", event, k8sEvent, "this run")
+	default:
+		l.perEntity[entityKey]++
+		l.perCheck[checkKey]++
+		l.total++
+		return true
+	}
+	return false
+}
+
+func (l *stormLimiter) suppress(key string, event *corev2.Event, k8sEvent k8scorev1.Event, description string) {
+	eventLog(k8sEvent).WithField("limit", key).Debug("Event filtered: event storm limit reached")
+	s, ok := l.suppressed[key]
+	if !ok {
+		s = &suppressedEvents{
+			event:       event,
+			object:      entityReference(k8sEvent),
+			reasons:     make(map[string]int),
+			namespaces:  make(map[string]bool),
+			description: description,
+		}
+		l.suppressed[key] = s
+		l.order = append(l.order, key)
+	}
+	s.count++
+	s.reasons[k8sEvent.Reason]++
+	_, namespace, _ := entityObject(k8sEvent)
+	s.namespaces[namespace] = true
+	if event.Check.Status > s.status {
+		s.status = event.Check.Status
+	}
+}
+
+// aggregated returns one event per exceeded limit, summarizing the events that
+// were suppressed, with the worst status among them.
+func (l *stormLimiter) aggregated() []summaryEvent {
+	events := []summaryEvent{}
+	for _, key := range l.order {
+		s := l.suppressed[key]
+
+		event := &corev2.Event{}
+		event.ObjectMeta.Namespace = s.event.ObjectMeta.Namespace
+		event.ObjectMeta.Labels = map[string]string{
+			"io.kubernetes.suppressed": strconv.Itoa(s.count),
+		}
+		event.Check = &corev2.Check{}
+		event.Check.ObjectMeta.Namespace = s.event.Check.ObjectMeta.Namespace
+		object := s.object
+		switch {
+		case strings.HasPrefix(key, "entity:"):
+			// Alert on the entity, under a check of its own
+			event.Check.ObjectMeta.Name = suppressedCheckName
+			event.Check.ProxyEntityName = s.event.Check.ProxyEntityName
+		case strings.HasPrefix(key, "check:"):
+			// Spans entities, so alert on their namespace
+			event.Check.ObjectMeta.Name = fmt.Sprintf("%s-suppressed", s.event.Check.ObjectMeta.Name)
+			event.Check.ProxyEntityName = namespaceEntityName(s.namespace())
+			object = namespaceReference(s.namespace())
+		default:
+			event.Check.ObjectMeta.Name = suppressedCheckName
+			event.Check.ProxyEntityName = namespaceEntityName(s.namespace())
+			object = namespaceReference(s.namespace())
+		}
+		event.Check.Status = s.status
+		event.Check.Interval = plugin.Interval
+		event.Check.Handlers = s.event.Check.Handlers
+		event.Timestamp = time.Now().Unix()
+		event.Check.Output = fmt.Sprintf("%d event(s) suppressed for %s, reasons: %s\n", s.count, s.description, formatCounts(s.reasons))
+		events = append(events, summaryEvent{Event: event, object: object})
+	}
+	return events
+}
+
+// formatCounts formats counts by key as "key (count), ...", by decreasing
+// count.
+func formatCounts(counts map[string]int) string {
+	return formatTopCounts(counts, 0)
+}
+
+// formatTopCounts formats the top n counts by key like formatCounts, or all
+// of them if n is 0.
+func formatTopCounts(counts map[string]int, n int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	formatted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		formatted = append(formatted, fmt.Sprintf("%s (%d)", key, counts[key]))
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	corev2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+func stormEvent(entity, check, reason string, status uint32) (*corev2.Event, k8scorev1.Event) {
+	event := &corev2.Event{Check: &corev2.Check{ProxyEntityName: entity, Status: status, Handlers: []string{"slack"}}}
+	event.Check.ObjectMeta.Name = check
+	k8sev := k8scorev1.Event{}
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Namespace = "default"
+	k8sev.InvolvedObject.Name = entity
+	k8sev.Reason = reason
+	return event, k8sev
+}
+
+func TestStormLimiter(t *testing.T) {
+	assert := assert.New(t)
+	plugin.MaxEventsPerEntity = 2
+	plugin.MaxEventsPerCheck = 3
+	plugin.MaxEventsPerRun = 5
+	defer func() {
+		plugin.MaxEventsPerEntity = 0
+		plugin.MaxEventsPerCheck = 0
+		plugin.MaxEventsPerRun = 0
+	}()
+
+	l := newStormLimiter()
+	testcases := []struct {
+		entity string
+		check  string
+		reason string
+		status uint32
+		allow  bool
+	}{
+		{"nginx-1", "pod-backoff", "BackOff", 1, true},
+		{"nginx-1", "pod-failed", "Failed", 1, true},
+		{"nginx-1", "pod-unhealthy", "Unhealthy", 2, false}, // per entity
+		{"nginx-1", "pod-killing", "Killing", 1, false},     // per entity
+		{"nginx-2", "pod-backoff", "BackOff", 1, true},
+		{"nginx-3", "pod-backoff", "BackOff", 1, true},
+		{"nginx-4", "pod-backoff", "BackOff", 1, false}, // per check
+		{"nginx-5", "pod-failed", "Failed", 1, true},
+		{"nginx-6", "pod-failed", "Failed", 1, false},       // per run
+		{"nginx-7", "pod-unhealthy", "Unhealthy", 2, false}, // per run
+	}
+	for _, tc := range testcases {
+		event, k8sev := stormEvent(tc.entity, tc.check, tc.reason, tc.status)
+		if tc.entity == "nginx-7" {
+			k8sev.InvolvedObject.Namespace = "web"
+		}
+		assert.Equal(tc.allow, l.allow(event, k8sev), "%+v", tc)
+	}
+
+	aggregated := l.aggregated()
+	assert.Len(aggregated, 3)
+
+	assert.Equal("kubernetes-events-suppressed", aggregated[0].Check.Name)
+	assert.Equal("nginx-1", aggregated[0].Check.ProxyEntityName)
+	assert.Equal("nginx-1", aggregated[0].object.Name)
+	assert.Equal(uint32(2), aggregated[0].Check.Status)
+	assert.Equal([]string{"slack"}, aggregated[0].Check.Handlers)
+	assert.Equal("2 event(s) suppressed for pod nginx-1, reasons: Killing (1), Unhealthy (1)\n", aggregated[0].Check.Output)
+	assert.Equal("2", aggregated[0].ObjectMeta.Labels["io.kubernetes.suppressed"])
+
+	assert.Equal("pod-backoff-suppressed", aggregated[1].Check.Name)
+	assert.Equal("default-namespace", aggregated[1].Check.ProxyEntityName)
+	assert.Equal(k8scorev1.ObjectReference{Kind: "Namespace", Name: "default"}, aggregated[1].object)
+	assert.Equal(uint32(1), aggregated[1].Check.Status)
+	assert.Equal("1 event(s) suppressed for check pod-backoff, reasons: BackOff (1)\n", aggregated[1].Check.Output)
+
+	assert.Equal("kubernetes-events-suppressed", aggregated[2].Check.Name)
+	assert.Equal("cluster", aggregated[2].Check.ProxyEntityName)
+	assert.Equal("Cluster", aggregated[2].object.Kind)
+	assert.Equal(uint32(2), aggregated[2].Check.Status)
+	assert.Equal("2 event(s) suppressed for this run, reasons: Failed (1), Unhealthy (1)\n", aggregated[2].Check.Output)
+}
+
+func TestStormLimiterUnlimited(t *testing.T) {
+	l := newStormLimiter()
+	for i := 0; i < 100; i++ {
+		event, k8sev := stormEvent("nginx-1", "pod-backoff", "BackOff", 1)
+		assert.True(t, l.allow(event, k8sev))
+	}
+	assert.Empty(t, l.aggregated())
+}
+
+func TestFormatCounts(t *testing.T) {
+	assert.Equal(t, "BackOff (3), Failed (1), Killing (1)", formatCounts(map[string]int{"Killing": 1, "BackOff": 3, "Failed": 1}))
+	assert.Equal(t, "", formatCounts(map[string]int{}))
+}
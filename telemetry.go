@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// telemetryPrefix prefixes the names of the metrics of the plugin itself.
+const telemetryPrefix = "sensu_kubernetes_events"
+
+// deliveryBuckets are the upper bounds, in seconds, of the delivery latency
+// histogram buckets.
+var deliveryBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// pluginTelemetry holds the metrics of the plugin itself, served in the
+// Prometheus text format on --metrics-addr in daemon mode.
+type pluginTelemetry struct {
+	mu sync.Mutex
+
+	received         int
+	filtered         map[string]int
+	mapped           int
+	delivered        int
+	deliveryFailures int
+	watchRestarts    int
+	apiErrors        map[string]int
+	configReloads    map[string]int
+	spooled          int
+	spoolReplayed    int
+	spoolDropped     int
+	// spoolDepths are the depths of the spools of the pipelines, by directory
+	spoolDepths map[string]int
+
+	// deliveryCounts are the cumulative counts of deliveryBuckets
+	deliveryCounts []int
+	deliveryCount  int
+	deliverySum    float64
+
+	ready bool
+	// identity is the leader election identity of this replica, if any
+	identity string
+	leader   bool
+	// shardMembers is the number of replicas sharing namespaces, if sharded
+	shardMembers int
+}
+
+func newPluginTelemetry() *pluginTelemetry {
+	return &pluginTelemetry{
+		filtered:       make(map[string]int),
+		apiErrors:      make(map[string]int),
+		configReloads:  make(map[string]int),
+		spoolDepths:    make(map[string]int),
+		deliveryCounts: make([]int, len(deliveryBuckets)),
+	}
+}
+
+// telemetry is the telemetry of this process.
+var telemetry = newPluginTelemetry()
+
+func (t *pluginTelemetry) eventReceived() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.received++
+}
+
+// eventFiltered records an event that was not sent, by reason (e.g. silenced).
+func (t *pluginTelemetry) eventFiltered(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filtered[reason]++
+}
+
+func (t *pluginTelemetry) eventMapped() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mapped++
+}
+
+// eventDelivered records the delivery of an event to a sink, successful or
+// not, and how long it took.
+func (t *pluginTelemetry) eventDelivered(duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.deliveryFailures++
+		return
+	}
+	t.delivered++
+	seconds := duration.Seconds()
+	t.deliveryCount++
+	t.deliverySum += seconds
+	for i, bound := range deliveryBuckets {
+		if seconds <= bound {
+			t.deliveryCounts[i]++
+		}
+	}
+}
+
+func (t *pluginTelemetry) watchRestarted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.watchRestarts++
+}
+
+// apiError records a failed request to an API (kubernetes or sensu).
+func (t *pluginTelemetry) apiError(api string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.apiErrors[api]++
+}
+
+// configReloaded records a reload of the --config file, successful or not.
+func (t *pluginTelemetry) configReloaded(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.configReloads["failure"]++
+		return
+	}
+	t.configReloads["success"]++
+}
+
+// eventsSpooled records events spooled, and dropped from the spool.
+func (t *pluginTelemetry) eventsSpooled(spooled, dropped int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spooled += spooled
+	t.spoolDropped += dropped
+}
+
+// eventsReplayed records spooled events delivered, and dropped as unreadable or
+// rejected.
+func (t *pluginTelemetry) eventsReplayed(replayed, dropped int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spoolReplayed += replayed
+	t.spoolDropped += dropped
+}
+
+// setSpoolDepth sets the depth of the spool of a pipeline.
+func (t *pluginTelemetry) setSpoolDepth(dir string, depth int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spoolDepths[dir] = depth
+}
+
+// setReady sets whether the watch of Kubernetes events is established.
+func (t *pluginTelemetry) setReady(ready bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ready = ready
+}
+
+// setLeader sets whether this replica, with the given identity, leads.
+func (t *pluginTelemetry) setLeader(identity string, leader bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.identity = identity
+	t.leader = leader
+}
+
+func (t *pluginTelemetry) setShardMembers(members int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.shardMembers = members
+}
+
+func (t *pluginTelemetry) isReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (t *pluginTelemetry) write(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counter := func(name, help string, value int) {
+		fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s counter\n", telemetryPrefix, name, help, telemetryPrefix, name)
+		fmt.Fprintf(w, "%s_%s %d\n", telemetryPrefix, name, value)
+	}
+	counterVec := func(name, help, label string, values map[string]int) {
+		fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s counter\n", telemetryPrefix, name, help, telemetryPrefix, name)
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s_%s{%s=\"%s\"} %d\n", telemetryPrefix, name, label, promReplacer.Replace(key), values[key])
+		}
+	}
+
+	counter("received_total", "Kubernetes events received.", t.received)
+	counterVec("filtered_total", "Kubernetes events not sent, by reason.", "reason", t.filtered)
+	counter("mapped_total", "Sensu events created from Kubernetes events.", t.mapped)
+	counter("delivered_total", "Sensu events delivered.", t.delivered)
+	counter("delivery_failures_total", "Sensu events that failed to be delivered.", t.deliveryFailures)
+	counter("watch_restarts_total", "Restarts of the watch of Kubernetes events.", t.watchRestarts)
+	counterVec("api_errors_total", "Failed API requests, by API.", "api", t.apiErrors)
+	counterVec("config_reloads_total", "Reloads of the --config file, by result.", "result", t.configReloads)
+	counter("spooled_total", "Sensu events spooled as they failed to be delivered.", t.spooled)
+	counter("spool_replayed_total", "Spooled Sensu events delivered.", t.spoolReplayed)
+	counter("spool_dropped_total", "Spooled Sensu events dropped, beyond the spool bound or undeliverable.", t.spoolDropped)
+	fmt.Fprintf(w, "# HELP %s_spool_depth Sensu events in the spool.\n# TYPE %s_spool_depth gauge\n", telemetryPrefix, telemetryPrefix)
+	spoolDepth := 0
+	for _, depth := range t.spoolDepths {
+		spoolDepth += depth
+	}
+	fmt.Fprintf(w, "%s_spool_depth %d\n", telemetryPrefix, spoolDepth)
+
+	if len(t.identity) > 0 {
+		leader := 0
+		if t.leader {
+			leader = 1
+		}
+		fmt.Fprintf(w, "# HELP %s_leader Whether this replica leads the leader election.\n# TYPE %s_leader gauge\n", telemetryPrefix, telemetryPrefix)
+		fmt.Fprintf(w, "%s_leader{identity=\"%s\"} %d\n", telemetryPrefix, promReplacer.Replace(t.identity), leader)
+	}
+
+	if t.shardMembers > 0 {
+		fmt.Fprintf(w, "# HELP %s_shard_members Replicas sharing namespaces.\n# TYPE %s_shard_members gauge\n", telemetryPrefix, telemetryPrefix)
+		fmt.Fprintf(w, "%s_shard_members %d\n", telemetryPrefix, t.shardMembers)
+	}
+
+	name := telemetryPrefix + "_delivery_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency of the delivery of Sensu events.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range deliveryBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, t.deliveryCounts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, t.deliveryCount)
+	fmt.Fprintf(w, "%s_sum %g\n", name, t.deliverySum)
+	fmt.Fprintf(w, "%s_count %d\n", name, t.deliveryCount)
+}
+
+// handler returns the HTTP handler serving /metrics, /healthz and /readyz.
+func (t *pluginTelemetry) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		t.write(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !t.isReady() {
+			http.Error(w, "not watching events", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryHandler(t *testing.T) {
+	assert := assert.New(t)
+	tm := newPluginTelemetry()
+	tm.eventReceived()
+	tm.eventReceived()
+	tm.eventFiltered("silenced")
+	tm.eventMapped()
+	tm.eventDelivered(20*time.Millisecond, nil)
+	tm.eventDelivered(time.Second, errors.New("refused"))
+	tm.apiError("sensu")
+	tm.watchRestarted()
+
+	server := httptest.NewServer(tm.handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/metrics")
+	assert.Equal(http.StatusOK, status)
+	assert.Contains(body, "sensu_kubernetes_events_received_total 2\n")
+	assert.Contains(body, "sensu_kubernetes_events_filtered_total{reason=\"silenced\"} 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_mapped_total 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_delivered_total 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_delivery_failures_total 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_watch_restarts_total 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_api_errors_total{api=\"sensu\"} 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_delivery_duration_seconds_bucket{le=\"0.01\"} 0\n")
+	assert.Contains(body, "sensu_kubernetes_events_delivery_duration_seconds_bucket{le=\"0.025\"} 1\n")
+	assert.Contains(body, "sensu_kubernetes_events_delivery_duration_seconds_count 1\n")
+
+	status, _ = get("/healthz")
+	assert.Equal(http.StatusOK, status)
+	status, _ = get("/readyz")
+	assert.Equal(http.StatusServiceUnavailable, status)
+	tm.setReady(true)
+	status, _ = get("/readyz")
+	assert.Equal(http.StatusOK, status)
+}
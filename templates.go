@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	k8scorev1 "k8s.io/api/core/v1"
+)
+
+// templateData is the data available to the --output-template and
+// --summary-template templates.
+type templateData struct {
+	// Event is the Kubernetes event
+	Event k8scorev1.Event
+	// Container is the name of the container referenced by the event, if any
+	Container string
+	// Count is the number of times the event has occurred
+	Count int32
+	// Age is the time since the event first occurred
+	Age time.Duration
+	// Cluster is the cluster name given by --cluster
+	Cluster string
+}
+
+var (
+	outputTemplate  *template.Template
+	summaryTemplate *template.Template
+
+	templateFuncs = template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}
+)
+
+// parseTemplate parses a user supplied template, returning nil for an empty
+// template text.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+func newTemplateData(k8sEvent k8scorev1.Event) templateData {
+	return templateData{
+		Event:     k8sEvent,
+		Container: containerName(k8sEvent.InvolvedObject.FieldPath),
+		Count:     k8sEvent.Count,
+		Age:       time.Since(k8sEvent.FirstTimestamp.Time).Round(time.Second),
+		Cluster:   plugin.Cluster,
+	}
+}
+
+func executeTemplate(tmpl *template.Template, k8sEvent k8scorev1.Event) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newTemplateData(k8sEvent)); err != nil {
+		return "", fmt.Errorf("Failed to execute %s for event %s: %v", tmpl.Name(), k8sEvent.ObjectMeta.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// eventSummary returns the line printed in the check output for each
+// Kubernetes event forwarded to Sensu.
+func eventSummary(k8sEvent k8scorev1.Event) (string, error) {
+	if summaryTemplate != nil {
+		return executeTemplate(summaryTemplate, k8sEvent)
+	}
+	return fmt.Sprintf(
+		"Event for %s %s in namespace %s, reason: %q, message: %q",
+		k8sEvent.InvolvedObject.Kind,
+		k8sEvent.ObjectMeta.Name,
+		k8sEvent.ObjectMeta.Namespace,
+		k8sEvent.Reason,
+		k8sEvent.Message,
+	), nil
+}
+
+// eventOutput returns the check output of the Sensu event created for a
+// Kubernetes event.
+func eventOutput(k8sEvent k8scorev1.Event) (string, error) {
+	if outputTemplate != nil {
+		return executeTemplate(outputTemplate, k8sEvent)
+	}
+	return fmt.Sprintf(
+		"Event for %s %s in namespace %s, reason: %q, message: %q\n",
+		k8sEvent.InvolvedObject.Kind,
+		k8sEvent.ObjectMeta.Name,
+		k8sEvent.ObjectMeta.Namespace,
+		k8sEvent.Reason,
+		k8sEvent.Message,
+	), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTemplate(t *testing.T) {
+	assert := assert.New(t)
+	tmpl, err := parseTemplate("output-template", "")
+	assert.NoError(err)
+	assert.Nil(tmpl)
+	tmpl, err = parseTemplate("output-template", "{{.Event.Reason}}")
+	assert.NoError(err)
+	assert.NotNil(tmpl)
+	_, err = parseTemplate("output-template", "{{.Event.Reason")
+	assert.Error(err)
+}
+
+func TestEventOutputAndSummary(t *testing.T) {
+	assert := assert.New(t)
+	k8sev := k8scorev1.Event{}
+	k8sev.ObjectMeta.Name = "nginx-1.162cb9a548a2a604"
+	k8sev.ObjectMeta.Namespace = "default"
+	k8sev.InvolvedObject.Kind = "Pod"
+	k8sev.InvolvedObject.Name = "nginx-1"
+	k8sev.InvolvedObject.FieldPath = "spec.containers{nginx}"
+	k8sev.Reason = "BackOff"
+	k8sev.Message = "Back-off restarting failed container"
+	k8sev.Count = 12
+	k8sev.FirstTimestamp = metav1.NewTime(time.Now().Add(-5 * time.Minute))
+
+	// Defaults
+	outputTemplate, summaryTemplate = nil, nil
+	out, err := eventOutput(k8sev)
+	assert.NoError(err)
+	assert.Equal("Event for Pod nginx-1.162cb9a548a2a604 in namespace default, reason: \"BackOff\", message: \"Back-off restarting failed container\"\n", out)
+	out, err = eventSummary(k8sev)
+	assert.NoError(err)
+	assert.Equal("Event for Pod nginx-1.162cb9a548a2a604 in namespace default, reason: \"BackOff\", message: \"Back-off restarting failed container\"", out)
+
+	// Templates
+	plugin.Cluster = "prod-eu"
+	defer func() {
+		plugin.Cluster = ""
+		outputTemplate, summaryTemplate = nil, nil
+	}()
+	outputTemplate, err = parseTemplate("output-template", "[{{.Cluster}}] {{.Event.InvolvedObject.Namespace}}/{{.Event.InvolvedObject.Name}} container {{.Container}}: {{.Event.Reason | upper}} x{{.Count}} over {{.Age}}")
+	require.NoError(t, err)
+	summaryTemplate, err = parseTemplate("summary-template", "{{.Event.Reason | lower}}: {{.Event.Message}}")
+	require.NoError(t, err)
+	k8sev.InvolvedObject.Namespace = "default"
+	out, err = eventOutput(k8sev)
+	assert.NoError(err)
+	assert.Equal("[prod-eu] default/nginx-1 container nginx: BACKOFF x12 over 5m0s", out)
+	out, err = eventSummary(k8sev)
+	assert.NoError(err)
+	assert.Equal("backoff: Back-off restarting failed container", out)
+
+	// Execution errors are reported
+	outputTemplate, err = parseTemplate("output-template", "{{.Event.NoSuchField}}")
+	require.NoError(t, err)
+	_, err = eventOutput(k8sev)
+	assert.Error(err)
+}